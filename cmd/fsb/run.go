@@ -4,13 +4,21 @@ import (
 	"EverythingSuckz/fsb/config"
 	"EverythingSuckz/fsb/internal/bot"
 	"EverythingSuckz/fsb/internal/cache"
+	"EverythingSuckz/fsb/internal/commands"
+	"EverythingSuckz/fsb/internal/database"
 	"EverythingSuckz/fsb/internal/routes"
 	"EverythingSuckz/fsb/internal/types"
 	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/celestix/gotgproto"
 	"github.com/spf13/cobra"
 
 	"github.com/gin-gonic/gin"
@@ -24,8 +32,6 @@ var runCmd = &cobra.Command{
 	Run:                runApp,
 }
 
-var startTime time.Time = time.Now()
-
 func runApp(cmd *cobra.Command, args []string) {
 	utils.InitLogger(config.ValueOf.Dev)
 	log := utils.Logger
@@ -39,20 +45,60 @@ func runApp(cmd *cobra.Command, args []string) {
 		log.Panic("Failed to start main bot", zap.Error(err))
 	}
 	cache.InitCache(log)
+	cache.InitChunkCache(log)
+	if err := database.Init(log); err != nil {
+		log.Panic("Failed to open database", zap.Error(err))
+	}
+	bot.LoadLogChannel(log)
 	workers, err := bot.StartWorkers(log)
 	if err != nil {
 		log.Panic("Failed to start workers", zap.Error(err))
 		return
 	}
 	workers.AddDefaultClient(mainBot, mainBot.Self)
+	// the userbot may create the log channel, which is never changed after
+	// this point
 	bot.StartUserBot(log)
+	// the handlers use the database, the caches and the log channel,
+	// updates may arrive as soon as they are registered
+	commands.Load(log, mainBot.Dispatcher)
+	bot.StartHealthCheck(log)
+	bot.WatchTokenFile(log)
 	mainLogger.Info("Server started", zap.Int("port", config.ValueOf.Port))
 	mainLogger.Info("File Stream Bot", zap.String("version", versionString))
 	mainLogger.Sugar().Infof("Server is running at %s", config.ValueOf.Host)
-	err = router.Run(fmt.Sprintf(":%d", config.ValueOf.Port))
-	if err != nil {
-		mainLogger.Sugar().Fatalln(err)
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", config.ValueOf.Port),
+		Handler: router,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			mainLogger.Sugar().Fatalln(err)
+		}
+	}()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	// a second signal kills the process right away
+	stop()
+	shutdown(mainLogger, server, mainBot)
+}
+
+// shutdown stops accepting requests, gives the streams in progress up to
+// SHUTDOWN_TIMEOUT to finish and stops the clients.
+func shutdown(log *zap.Logger, server *http.Server, mainBot *gotgproto.Client) {
+	timeout := config.ValueOf.ShutdownTimeout
+	log.Sugar().Infof("Shutting down, waiting up to %s for streams to finish", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warn("Streams didn't finish in time, closing them", zap.Error(err))
+		server.Close()
 	}
+	mainBot.Stop()
+	bot.Workers.Stop()
+	bot.UserBot.Stop()
+	log.Info("Server stopped")
+	utils.CloseLogger()
 }
 
 func getRouter(log *zap.Logger) *gin.Engine {
@@ -62,12 +108,12 @@ func getRouter(log *zap.Logger) *gin.Engine {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	router := gin.Default()
-	router.Use(gin.ErrorLogger())
+	router.Use(gin.ErrorLogger(), routes.RecordMetrics)
 	router.GET("/", func(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, types.RootResponse{
 			Message: "Server is running.",
 			Ok:      true,
-			Uptime:  utils.TimeFormat(uint64(time.Since(startTime).Seconds())),
+			Uptime:  utils.TimeFormat(uint64(time.Since(utils.StartTime).Seconds())),
 			Version: versionString,
 		})
 	})
@@ -9,8 +9,10 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -38,23 +40,63 @@ func (au *allowedUsers) Decode(value string) error {
 }
 
 type config struct {
-	APIID            int64    `envconfig:"API_ID" required:"true"`
-	APIHash          string   `envconfig:"API_HASH" required:"true"`
-	BotToken         string   `envconfig:"BOT_TOKEN" required:"true"`
-	LogChannelID     int64    `envconfig:"LOG_CHANNEL" required:"true"`
-	Host             string   `envconfig:"HOST" required:"true"`
-	Port             int      `envconfig:"PORT" required:"true"`
-	AllowedUsers     []int64  `envconfig:"ALLOWED_USERS"`
-	ForceSubChannel  string   `envconfig:"FORCE_SUB_CHANNEL"`
-	Dev              bool     `envconfig:"DEV" default:"false"`
-	HashLength       int      `envconfig:"HASH_LENGTH" default:"6"`
-	UseSessionFile   bool     `envconfig:"USE_SESSION_FILE" default:"true"`
-	UserSession      string   `envconfig:"USER_SESSION"`
-	UsePublicIP      bool     `envconfig:"USE_PUBLIC_IP" default:"false"`
-	MultiTokens      []string
+	APIID               int64          `envconfig:"API_ID" required:"true"`
+	APIHash             string         `envconfig:"API_HASH" required:"true"`
+	BotToken            string         `envconfig:"BOT_TOKEN" required:"true"`
+	LogChannelID        int64          `envconfig:"LOG_CHANNEL"`
+	Host                string         `envconfig:"HOST" required:"true"`
+	Port                int            `envconfig:"PORT" required:"true"`
+	AllowedUsers        []int64        `envconfig:"ALLOWED_USERS"`
+	Admins              []int64        `envconfig:"ADMINS"`
+	AdminToken          string         `envconfig:"ADMIN_TOKEN"`
+	MetricsToken        string         `envconfig:"METRICS_TOKEN"`
+	DatabasePath        string         `envconfig:"DATABASE_PATH" default:"fsb.db"`
+	ForceSubChannel     string         `envconfig:"FORCE_SUB_CHANNEL"`
+	Dev                 bool           `envconfig:"DEV" default:"false"`
+	HashLength          int            `envconfig:"HASH_LENGTH" default:"16"`
+	HashSecrets         []string       `envconfig:"HASH_SECRETS"`
+	LegacyHash          bool           `envconfig:"LEGACY_HASH" default:"false"`
+	LegacyHashLength    int            `envconfig:"LEGACY_HASH_LENGTH" default:"6"`
+	LinkTTL             time.Duration  `envconfig:"LINK_TTL" default:"24h"`
+	MaxLinkTTL          time.Duration  `envconfig:"MAX_LINK_TTL" default:"0"`
+	UseSessionFile      bool           `envconfig:"USE_SESSION_FILE" default:"true"`
+	UserSession         string         `envconfig:"USER_SESSION"`
+	UserBotWorker       bool           `envconfig:"USERBOT_WORKER" default:"false"`
+	UserBotWeight       int            `envconfig:"USERBOT_WEIGHT" default:"1"`
+	LinkChannels        []string       `envconfig:"LINK_CHANNELS"`
+	UsePublicIP         bool           `envconfig:"USE_PUBLIC_IP" default:"false"`
+	StreamConcurrency   int            `envconfig:"STREAM_CONCURRENCY" default:"4"`
+	StripeMinSize       int64          `envconfig:"STRIPE_MIN_SIZE" default:"50"`
+	WorkerStrategy      string         `envconfig:"WORKER_STRATEGY" default:"round-robin"`
+	WorkerWeights       map[string]int `envconfig:"WORKER_WEIGHTS"`
+	HealthCheckInterval time.Duration  `envconfig:"HEALTH_CHECK_INTERVAL" default:"1m"`
+	DrainTimeout        time.Duration  `envconfig:"DRAIN_TIMEOUT" default:"10m"`
+	ShutdownTimeout     time.Duration  `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+	MaxFailovers        int            `envconfig:"MAX_FAILOVERS" default:"3"`
+	ChunkCacheSize      int64          `envconfig:"CHUNK_CACHE_SIZE" default:"0"`
+	ChunkCacheDir       string         `envconfig:"CHUNK_CACHE_DIR" default:"chunks"`
+	MultiTokenTxtFile   string         `envconfig:"MULTI_TOKEN_TXT_FILE"`
+	MultiTokens         []string
 }
 
-var botTokenRegex = regexp.MustCompile(`MULTI\_TOKEN\d+=(.*)`)
+var botTokenRegex = regexp.MustCompile(`^MULTI\_TOKEN\d+=(.*)`)
+
+// ReadTokenFile returns the bot tokens listed in the file, one per line.
+// Blank lines and everything after a # are ignored.
+func ReadTokenFile(path string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	var tokens []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" && !slices.Contains(tokens, line) {
+			tokens = append(tokens, line)
+		}
+	}
+	return tokens, nil
+}
 
 func (c *config) loadFromEnvFile(log *zap.Logger) {
 	envPath := filepath.Clean("fsb.env")
@@ -80,12 +122,33 @@ func (c *config) SetFlagsFromConfig(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&c.Host, "host", "", "Host URL")
 	cmd.Flags().IntVar(&c.Port, "port", 0, "Port")
 	cmd.Flags().StringVar(&c.ForceSubChannel, "force-sub-channel", "", "Force Subscription Channel Username")
+	cmd.Flags().String("admin-token", c.AdminToken, "Token for the admin HTTP endpoints")
+	cmd.Flags().String("metrics-token", c.MetricsToken, "Token required to read /metrics (empty to leave it open)")
+	cmd.Flags().String("database-path", c.DatabasePath, "Path of the database file")
 	cmd.Flags().Bool("dev", c.Dev, "Enable development mode")
 	cmd.Flags().Int("hash-length", c.HashLength, "Hash length in links")
+	cmd.Flags().StringSlice("hash-secrets", c.HashSecrets, "Secrets used to sign links, the first one signs new links")
+	cmd.Flags().Bool("legacy-hash", c.LegacyHash, "Also accept unsigned links generated by older versions")
+	cmd.Flags().Int("legacy-hash-length", c.LegacyHashLength, "HASH_LENGTH the legacy links were generated with")
+	cmd.Flags().Duration("link-ttl", c.LinkTTL, "How long generated links stay valid (0 for unlimited)")
+	cmd.Flags().Duration("max-link-ttl", c.MaxLinkTTL, "Longest TTL users may request for a link (0 for unlimited)")
 	cmd.Flags().Bool("use-session-file", c.UseSessionFile, "Use session files")
 	cmd.Flags().String("user-session", c.UserSession, "Pyrogram user session")
+	cmd.Flags().Bool("userbot-worker", c.UserBotWorker, "Also stream with the userbot, like a worker bot")
+	cmd.Flags().Int("userbot-weight", c.UserBotWeight, "Weight of the userbot for the weighted strategy")
+	cmd.Flags().StringSlice("link-channels", c.LinkChannels, "Channels (usernames or IDs) whose t.me message links the userbot may copy files from")
 	cmd.Flags().Bool("use-public-ip", c.UsePublicIP, "Use public IP instead of local IP")
-	cmd.Flags().String("multi-token-txt-file", "", "Multi token txt file (Not implemented)")
+	cmd.Flags().Int("stream-concurrency", c.StreamConcurrency, "Number of chunks fetched ahead per stream")
+	cmd.Flags().Int64("stripe-min-size", c.StripeMinSize, "Minimum file size in MiB to spread a stream across all workers (0 to disable)")
+	cmd.Flags().String("worker-strategy", c.WorkerStrategy, "How workers are picked: round-robin, least-active, weighted or least-recent-error")
+	cmd.Flags().StringToInt("worker-weights", c.WorkerWeights, "Weights of the worker bots for the weighted strategy (username=weight)")
+	cmd.Flags().Duration("health-check-interval", c.HealthCheckInterval, "How often worker health is checked (0 to disable)")
+	cmd.Flags().Duration("drain-timeout", c.DrainTimeout, "How long in-flight streams may take to finish before a worker is stopped")
+	cmd.Flags().Duration("shutdown-timeout", c.ShutdownTimeout, "How long in-flight streams may take to finish when the server shuts down")
+	cmd.Flags().Int("max-failovers", c.MaxFailovers, "How many times a stream may switch to another worker after errors")
+	cmd.Flags().Int64("chunk-cache-size", c.ChunkCacheSize, "Size cap of the on-disk chunk cache in MiB (0 to disable)")
+	cmd.Flags().String("chunk-cache-dir", c.ChunkCacheDir, "Directory of the on-disk chunk cache")
+	cmd.Flags().String("multi-token-txt-file", c.MultiTokenTxtFile, "File with worker bot tokens, one per line, reloaded on changes")
 }
 
 func (c *config) loadConfigFromArgs(log *zap.Logger, cmd *cobra.Command) {
@@ -110,6 +173,18 @@ func (c *config) loadConfigFromArgs(log *zap.Logger, cmd *cobra.Command) {
 	if c.ForceSubChannel != "" {
 		os.Setenv("FORCE_SUB_CHANNEL", c.ForceSubChannel)
 	}
+	metricsToken, _ := cmd.Flags().GetString("metrics-token")
+	if metricsToken != "" {
+		os.Setenv("METRICS_TOKEN", metricsToken)
+	}
+	adminToken, _ := cmd.Flags().GetString("admin-token")
+	if adminToken != "" {
+		os.Setenv("ADMIN_TOKEN", adminToken)
+	}
+	databasePath, _ := cmd.Flags().GetString("database-path")
+	if databasePath != "" {
+		os.Setenv("DATABASE_PATH", databasePath)
+	}
 	dev, _ := cmd.Flags().GetBool("dev")
 	if dev {
 		os.Setenv("DEV", strconv.FormatBool(dev))
@@ -118,6 +193,26 @@ func (c *config) loadConfigFromArgs(log *zap.Logger, cmd *cobra.Command) {
 	if hashLength != 0 {
 		os.Setenv("HASH_LENGTH", strconv.Itoa(hashLength))
 	}
+	hashSecrets, _ := cmd.Flags().GetStringSlice("hash-secrets")
+	if len(hashSecrets) != 0 {
+		os.Setenv("HASH_SECRETS", strings.Join(hashSecrets, ","))
+	}
+	legacyHash, _ := cmd.Flags().GetBool("legacy-hash")
+	if legacyHash {
+		os.Setenv("LEGACY_HASH", strconv.FormatBool(legacyHash))
+	}
+	legacyHashLength, _ := cmd.Flags().GetInt("legacy-hash-length")
+	if legacyHashLength != 0 {
+		os.Setenv("LEGACY_HASH_LENGTH", strconv.Itoa(legacyHashLength))
+	}
+	if cmd.Flags().Changed("link-ttl") {
+		linkTTL, _ := cmd.Flags().GetDuration("link-ttl")
+		os.Setenv("LINK_TTL", linkTTL.String())
+	}
+	maxLinkTTL, _ := cmd.Flags().GetDuration("max-link-ttl")
+	if maxLinkTTL != 0 {
+		os.Setenv("MAX_LINK_TTL", maxLinkTTL.String())
+	}
 	useSessionFile, _ := cmd.Flags().GetBool("use-session-file")
 	if useSessionFile {
 		os.Setenv("USE_SESSION_FILE", strconv.FormatBool(useSessionFile))
@@ -126,14 +221,69 @@ func (c *config) loadConfigFromArgs(log *zap.Logger, cmd *cobra.Command) {
 	if userSession != "" {
 		os.Setenv("USER_SESSION", userSession)
 	}
+	userBotWorker, _ := cmd.Flags().GetBool("userbot-worker")
+	if userBotWorker {
+		os.Setenv("USERBOT_WORKER", strconv.FormatBool(userBotWorker))
+	}
+	userBotWeight, _ := cmd.Flags().GetInt("userbot-weight")
+	if userBotWeight != 0 {
+		os.Setenv("USERBOT_WEIGHT", strconv.Itoa(userBotWeight))
+	}
+	linkChannels, _ := cmd.Flags().GetStringSlice("link-channels")
+	if len(linkChannels) != 0 {
+		os.Setenv("LINK_CHANNELS", strings.Join(linkChannels, ","))
+	}
 	usePublicIP, _ := cmd.Flags().GetBool("use-public-ip")
 	if usePublicIP {
 		os.Setenv("USE_PUBLIC_IP", strconv.FormatBool(usePublicIP))
 	}
+	streamConcurrency, _ := cmd.Flags().GetInt("stream-concurrency")
+	if streamConcurrency != 0 {
+		os.Setenv("STREAM_CONCURRENCY", strconv.Itoa(streamConcurrency))
+	}
+	if cmd.Flags().Changed("stripe-min-size") {
+		stripeMinSize, _ := cmd.Flags().GetInt64("stripe-min-size")
+		os.Setenv("STRIPE_MIN_SIZE", strconv.FormatInt(stripeMinSize, 10))
+	}
+	workerStrategy, _ := cmd.Flags().GetString("worker-strategy")
+	if workerStrategy != "" {
+		os.Setenv("WORKER_STRATEGY", workerStrategy)
+	}
+	workerWeights, _ := cmd.Flags().GetStringToInt("worker-weights")
+	if len(workerWeights) != 0 {
+		weights := make([]string, 0, len(workerWeights))
+		for username, weight := range workerWeights {
+			weights = append(weights, username+":"+strconv.Itoa(weight))
+		}
+		os.Setenv("WORKER_WEIGHTS", strings.Join(weights, ","))
+	}
+	if cmd.Flags().Changed("health-check-interval") {
+		healthCheckInterval, _ := cmd.Flags().GetDuration("health-check-interval")
+		os.Setenv("HEALTH_CHECK_INTERVAL", healthCheckInterval.String())
+	}
+	if cmd.Flags().Changed("drain-timeout") {
+		drainTimeout, _ := cmd.Flags().GetDuration("drain-timeout")
+		os.Setenv("DRAIN_TIMEOUT", drainTimeout.String())
+	}
+	if cmd.Flags().Changed("shutdown-timeout") {
+		shutdownTimeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+		os.Setenv("SHUTDOWN_TIMEOUT", shutdownTimeout.String())
+	}
+	if cmd.Flags().Changed("max-failovers") {
+		maxFailovers, _ := cmd.Flags().GetInt("max-failovers")
+		os.Setenv("MAX_FAILOVERS", strconv.Itoa(maxFailovers))
+	}
+	chunkCacheSize, _ := cmd.Flags().GetInt64("chunk-cache-size")
+	if chunkCacheSize != 0 {
+		os.Setenv("CHUNK_CACHE_SIZE", strconv.FormatInt(chunkCacheSize, 10))
+	}
+	chunkCacheDir, _ := cmd.Flags().GetString("chunk-cache-dir")
+	if chunkCacheDir != "" {
+		os.Setenv("CHUNK_CACHE_DIR", chunkCacheDir)
+	}
 	multiTokens, _ := cmd.Flags().GetString("multi-token-txt-file")
 	if multiTokens != "" {
 		os.Setenv("MULTI_TOKEN_TXT_FILE", multiTokens)
-		// TODO: Add support for importing tokens from a separate file
 	}
 }
 
@@ -164,8 +314,8 @@ func (c *config) setupEnvVars(log *zap.Logger, cmd *cobra.Command) {
 	}
 	val := reflect.ValueOf(c).Elem()
 	for _, env := range os.Environ() {
-		if strings.HasPrefix(env, "MULTI_TOKEN") {
-			c.MultiTokens = append(c.MultiTokens, botTokenRegex.FindStringSubmatch(env)[1])
+		if match := botTokenRegex.FindStringSubmatch(env); match != nil {
+			c.MultiTokens = append(c.MultiTokens, match[1])
 		}
 	}
 	val.FieldByName("MultiTokens").Set(reflect.ValueOf(c.MultiTokens))
@@ -176,17 +326,81 @@ func Load(log *zap.Logger, cmd *cobra.Command) {
 	defer log.Info("Loaded config")
 	ValueOf.setupEnvVars(log, cmd)
 	ValueOf.LogChannelID = int64(stripInt(log, int(ValueOf.LogChannelID)))
+	if ValueOf.LogChannelID == 0 {
+		if ValueOf.UserSession == "" {
+			log.Fatal("LOG_CHANNEL is required when USER_SESSION isn't set")
+		}
+		log.Sugar().Info("LOG_CHANNEL not set, the userbot will provide one")
+	}
 	if ValueOf.HashLength == 0 {
-		log.Sugar().Info("HASH_LENGTH can't be 0, defaulting to 6")
-		ValueOf.HashLength = 6
+		log.Sugar().Info("HASH_LENGTH can't be 0, defaulting to 16")
+		ValueOf.HashLength = 16
 	}
-	if ValueOf.HashLength > 32 {
-		log.Sugar().Info("HASH_LENGTH can't be more than 32, changing to 32")
-		ValueOf.HashLength = 32
+	if ValueOf.HashLength > 64 {
+		log.Sugar().Info("HASH_LENGTH can't be more than 64, changing to 64")
+		ValueOf.HashLength = 64
 	}
 	if ValueOf.HashLength < 5 {
-		log.Sugar().Info("HASH_LENGTH can't be less than 5, defaulting to 6")
-		ValueOf.HashLength = 6
+		log.Sugar().Info("HASH_LENGTH can't be less than 5, defaulting to 16")
+		ValueOf.HashLength = 16
+	}
+	if ValueOf.HashLength < 12 {
+		log.Sugar().Warnf("HASH_LENGTH of %d can be brute-forced, consider using at least 12", ValueOf.HashLength)
+	}
+	if len(ValueOf.HashSecrets) == 0 {
+		log.Sugar().Info("HASH_SECRETS not set, using BOT_TOKEN as the secret to sign links")
+		ValueOf.HashSecrets = []string{ValueOf.BotToken}
+	}
+	if ValueOf.LegacyHash {
+		log.Sugar().Warn("LEGACY_HASH is enabled, unsigned links can be forged by anyone who knows the file")
+	}
+	if ValueOf.LegacyHashLength < 5 || ValueOf.LegacyHashLength > 32 {
+		log.Sugar().Info("LEGACY_HASH_LENGTH must be between 5 and 32, defaulting to 6")
+		ValueOf.LegacyHashLength = 6
+	}
+	weights := make(map[string]int, len(ValueOf.WorkerWeights))
+	for username, weight := range ValueOf.WorkerWeights {
+		weights[strings.ToLower(strings.TrimPrefix(username, "@"))] = weight
+	}
+	ValueOf.WorkerWeights = weights
+	if ValueOf.UserBotWeight < 1 {
+		log.Sugar().Info("USERBOT_WEIGHT can't be less than 1, defaulting to 1")
+		ValueOf.UserBotWeight = 1
+	}
+	if ValueOf.UserBotWorker && ValueOf.UserSession == "" {
+		log.Sugar().Warn("USERBOT_WORKER is enabled but USER_SESSION is empty")
+	}
+	channels := make([]string, 0, len(ValueOf.LinkChannels))
+	for _, channel := range ValueOf.LinkChannels {
+		// IDs are compared without the -100 prefix of the bot API
+		channel = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(channel), "@"), "-100")
+		if channel != "" {
+			channels = append(channels, strings.ToLower(channel))
+		}
+	}
+	ValueOf.LinkChannels = channels
+	if len(ValueOf.LinkChannels) != 0 && ValueOf.UserSession == "" {
+		log.Sugar().Warn("LINK_CHANNELS is set but USER_SESSION is empty, message links won't work")
+	}
+	if ValueOf.MaxFailovers < 0 {
+		log.Sugar().Info("MAX_FAILOVERS can't be negative, defaulting to 3")
+		ValueOf.MaxFailovers = 3
+	}
+	if ValueOf.LinkTTL < 0 {
+		log.Sugar().Info("LINK_TTL can't be negative, defaulting to 24h")
+		ValueOf.LinkTTL = 24 * time.Hour
+	}
+	if ValueOf.MaxLinkTTL > 0 && (ValueOf.LinkTTL == 0 || ValueOf.LinkTTL > ValueOf.MaxLinkTTL) {
+		log.Sugar().Infof("LINK_TTL can't be more than MAX_LINK_TTL, changing to %s", ValueOf.MaxLinkTTL)
+		ValueOf.LinkTTL = ValueOf.MaxLinkTTL
+	}
+	if ValueOf.StreamConcurrency < 1 {
+		log.Sugar().Info("STREAM_CONCURRENCY can't be less than 1, defaulting to 4")
+		ValueOf.StreamConcurrency = 4
+	}
+	if ValueOf.StreamConcurrency > 16 {
+		log.Sugar().Info("STREAM_CONCURRENCY can't be more than 16, changing to 16")
+		ValueOf.StreamConcurrency = 16
 	}
 }
 
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadTokenFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"one per line", "111:aaa\n222:bbb\n", []string{"111:aaa", "222:bbb"}},
+		{"no trailing newline", "111:aaa\n222:bbb", []string{"111:aaa", "222:bbb"}},
+		{"blank lines", "\n111:aaa\n\n  \t\n222:bbb\n\n", []string{"111:aaa", "222:bbb"}},
+		{"comments", "# workers\n111:aaa # first\n#222:bbb\n333:ccc#third\n", []string{"111:aaa", "333:ccc"}},
+		{"whitespace and CRLF", "  111:aaa  \r\n\t222:bbb\r\n", []string{"111:aaa", "222:bbb"}},
+		{"duplicates", "111:aaa\n222:bbb\n111:aaa\n 222:bbb # again\n", []string{"111:aaa", "222:bbb"}},
+		{"only comments", "# nothing yet\n\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadTokenFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ReadTokenFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := ReadTokenFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Errorf("ReadTokenFile() of a missing file returned no error")
+	}
+}
@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
+
+// ErrChannelNotAllowed is returned for channels missing from LINK_CHANNELS.
+var ErrChannelNotAllowed = errors.New("files can't be taken from this channel")
+
+// CopyToLogChannel copies the media of a channel message into the log
+// channel with the userbot and returns the copy. channel is the username
+// of a public channel, or the ID of a private one as found in t.me/c/
+// links.
+func (u *UserBotStruct) CopyToLogChannel(ctx context.Context, channel string, messageID int) (*tg.Message, error) {
+	if u.client == nil {
+		return nil, errors.New("message links need a userbot, USER_SESSION isn't set")
+	}
+	// resolving usernames is heavily flood limited, users must not be able
+	// to make the userbot resolve whatever they like
+	if !slices.Contains(config.ValueOf.LinkChannels, strings.ToLower(channel)) {
+		return nil, ErrChannelNotAllowed
+	}
+	source, err := u.resolveChannel(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+	// a channel listed by ID may be linked by username and the other way
+	// around, the resolved channel tells both
+	if !linkChannelAllowed(source) {
+		return nil, ErrChannelNotAllowed
+	}
+	res, err := u.client.API().ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+		Channel: source.AsInput(),
+		ID:      []tg.InputMessageClass{&tg.InputMessageID{ID: messageID}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	messages, ok := res.(*tg.MessagesChannelMessages)
+	if !ok || len(messages.Messages) == 0 {
+		return nil, errors.New("message not found")
+	}
+	message, ok := messages.Messages[0].(*tg.Message)
+	if !ok {
+		return nil, errors.New("message not found")
+	}
+	var media tg.InputMediaClass
+	switch m := message.Media.(type) {
+	case *tg.MessageMediaDocument:
+		document, ok := m.Document.AsNotEmpty()
+		if !ok {
+			return nil, errors.New("message has no file")
+		}
+		media = &tg.InputMediaDocument{ID: document.AsInput()}
+	case *tg.MessageMediaPhoto:
+		photo, ok := m.Photo.AsNotEmpty()
+		if !ok {
+			return nil, errors.New("message has no file")
+		}
+		media = &tg.InputMediaPhoto{ID: photo.AsInput()}
+	default:
+		return nil, errors.New("message has no file")
+	}
+	logChannel, err := u.inputLogChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// sending the media again instead of forwarding leaves out the
+	// forward header, which would point back to the source channel
+	updates, err := u.client.API().MessagesSendMedia(ctx, &tg.MessagesSendMediaRequest{
+		Peer:     &tg.InputPeerChannel{ChannelID: logChannel.ChannelID, AccessHash: logChannel.AccessHash},
+		Media:    media,
+		Message:  message.Message,
+		Entities: message.Entities,
+		RandomID: rand.Int63(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if withUpdates, ok := updates.(*tg.Updates); ok {
+		for _, update := range withUpdates.Updates {
+			if update, ok := update.(*tg.UpdateNewChannelMessage); ok {
+				if copied, ok := update.Message.(*tg.Message); ok {
+					return copied, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected type %T", updates)
+}
+
+func (u *UserBotStruct) resolveChannel(ctx context.Context, channel string) (*tg.Channel, error) {
+	if id, err := strconv.ParseInt(channel, 10, 64); err == nil {
+		inputChannel := &tg.InputChannel{ChannelID: id}
+		if peer, ok := u.client.PeerStorage.GetInputPeerById(id).(*tg.InputPeerChannel); ok {
+			inputChannel.AccessHash = peer.AccessHash
+		}
+		channels, err := u.client.API().ChannelsGetChannels(ctx, []tg.InputChannelClass{inputChannel})
+		if err != nil {
+			return nil, err
+		}
+		for _, chat := range channels.GetChats() {
+			if c, ok := chat.(*tg.Channel); ok {
+				return c, nil
+			}
+		}
+		return nil, errors.New("channel not found, is the userbot a member?")
+	}
+	resolved, err := u.client.API().ContactsResolveUsername(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+	for _, chat := range resolved.GetChats() {
+		if c, ok := chat.(*tg.Channel); ok {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("channel %s not found", channel)
+}
+
+// linkChannelAllowed reports whether LINK_CHANNELS lists the channel, by
+// username or ID.
+func linkChannelAllowed(channel *tg.Channel) bool {
+	return slices.Contains(config.ValueOf.LinkChannels, strconv.FormatInt(channel.ID, 10)) ||
+		(channel.Username != "" && slices.Contains(config.ValueOf.LinkChannels, strings.ToLower(channel.Username)))
+}
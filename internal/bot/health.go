@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/celestix/gotgproto"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+const (
+	// pings failing in a row before a worker is quarantined
+	maxPingFailures = 2
+	pingTimeout     = 15 * time.Second
+	restartTimeout  = 30 * time.Second
+	minBackoff      = 30 * time.Second
+	maxBackoff      = 30 * time.Minute
+)
+
+// health is the state of a worker as seen by the health checker. Apart
+// from quarantined, it is only touched by the checker goroutine.
+type health struct {
+	quarantined atomic.Bool
+	failures    int
+	backoff     time.Duration
+	retryAt     time.Time
+}
+
+// Quarantined reports whether the worker is kept out of the rotation.
+func (w *Worker) Quarantined() bool {
+	return w.quarantined.Load()
+}
+
+// Status describes the state of the worker for humans.
+func (w *Worker) Status() string {
+	if w.Quarantined() {
+		return "quarantined"
+	}
+	if w.FloodWait() > 0 {
+		return "flood waiting"
+	}
+	return "healthy"
+}
+
+func (w *Worker) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	_, err := w.Client().API().UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUserSelf{}})
+	return err
+}
+
+// restart replaces the client of the worker with a freshly logged in one.
+func (w *Worker) restart() error {
+	if w.token == "" {
+		return errors.New("worker can't be restarted")
+	}
+	w.Client().Stop()
+	done := make(chan struct {
+		client *gotgproto.Client
+		err    error
+	}, 1)
+	go func() {
+		client, err := startWorker(w.log, w.token, w.ID, w.floodWait)
+		done <- struct {
+			client *gotgproto.Client
+			err    error
+		}{client, err}
+	}()
+	select {
+	case result := <-done:
+		if result.err != nil {
+			return result.err
+		}
+		w.client.Store(result.client)
+		return nil
+	case <-time.After(restartTimeout):
+		go func() {
+			// don't leave a client running that nobody uses
+			if result := <-done; result.client != nil {
+				result.client.Stop()
+			}
+		}()
+		return errors.New("timed out restarting worker")
+	}
+}
+
+func (w *Worker) checkHealth() {
+	log := w.log.With(zap.Int("workerID", w.ID), zap.String("username", w.Self.Username))
+	if !w.Quarantined() {
+		err := w.ping()
+		if err == nil {
+			w.failures = 0
+			return
+		}
+		w.failures++
+		log.Warn("Health check failed", zap.Int("failures", w.failures), zap.Error(err))
+		if w.failures < maxPingFailures {
+			return
+		}
+		w.backoff = minBackoff
+		w.retryAt = time.Now().Add(w.backoff)
+		w.quarantined.Store(true)
+		log.Warn("Worker quarantined", zap.Duration("retryIn", w.backoff))
+		return
+	}
+	if time.Now().Before(w.retryAt) {
+		return
+	}
+	err := w.ping()
+	if err != nil && w.token != "" {
+		log.Info("Restarting worker", zap.Error(err))
+		if err = w.restart(); err == nil {
+			err = w.ping()
+		}
+	}
+	if err != nil {
+		w.backoff = min(w.backoff*2, maxBackoff)
+		w.retryAt = time.Now().Add(w.backoff)
+		log.Warn("Worker still unhealthy", zap.Duration("retryIn", w.backoff), zap.Error(err))
+		return
+	}
+	w.failures = 0
+	w.quarantined.Store(false)
+	log.Info("Worker recovered, back in rotation")
+}
+
+// StartHealthCheck pings every worker once per HEALTH_CHECK_INTERVAL in
+// the background. Workers failing the checks are quarantined until they
+// recover, bot workers get restarted with an exponential backoff.
+func StartHealthCheck(log *zap.Logger) {
+	log = log.Named("Health")
+	interval := config.ValueOf.HealthCheckInterval
+	if interval <= 0 {
+		log.Info("Health checks disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if Workers.stopped.Load() {
+				return
+			}
+			Workers.checkHealth()
+		}
+	}()
+	log.Sugar().Infof("Checking worker health every %s", interval)
+}
+
+func (w *BotWorkers) checkHealth() {
+	var wg sync.WaitGroup
+	for _, worker := range w.List() {
+		wg.Add(1)
+		go func(worker *Worker) {
+			defer wg.Done()
+			worker.checkHealth()
+		}(worker)
+	}
+	wg.Wait()
+}
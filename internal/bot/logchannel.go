@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/celestix/gotgproto/storage"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+)
+
+// LoadLogChannel switches to the log channel the userbot created in a
+// previous run, unless LOG_CHANNEL was changed since.
+func LoadLogChannel(log *zap.Logger) {
+	log = log.Named("LogChannel")
+	channelID, replaced, err := database.GetLogChannel()
+	if err != nil {
+		log.Error("Failed to load the log channel from the database", zap.Error(err))
+		return
+	}
+	if channelID == 0 || (config.ValueOf.LogChannelID != 0 && config.ValueOf.LogChannelID != replaced) {
+		return
+	}
+	config.ValueOf.LogChannelID = channelID
+	log.Info("Using the log channel created by the userbot", zap.Int64("channelID", channelID))
+}
+
+// inputLogChannel resolves LOG_CHANNEL with the userbot.
+func (u *UserBotStruct) inputLogChannel(ctx context.Context) (*tg.InputChannel, error) {
+	channelID := config.ValueOf.LogChannelID
+	if peer, ok := u.client.PeerStorage.GetInputPeerById(channelID).(*tg.InputPeerChannel); ok {
+		return &tg.InputChannel{ChannelID: peer.ChannelID, AccessHash: peer.AccessHash}, nil
+	}
+	return getChannel(ctx, u.client.API(), channelID)
+}
+
+func getChannel(ctx context.Context, api *tg.Client, channelID int64) (*tg.InputChannel, error) {
+	channels, err := api.ChannelsGetChannels(ctx, []tg.InputChannelClass{&tg.InputChannel{ChannelID: channelID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(channels.GetChats()) == 0 {
+		return nil, errors.New("no channels found")
+	}
+	channel, ok := channels.GetChats()[0].(*tg.Channel)
+	if !ok {
+		return nil, errors.New("type assertion to *tg.Channel failed")
+	}
+	return channel.AsInput(), nil
+}
+
+// channelUnreachable reports whether Telegram definitely refused access to
+// the channel.
+func channelUnreachable(err error) bool {
+	return tgerr.Is(err, "CHANNEL_INVALID", "CHANNEL_PRIVATE", "CHANNEL_ID_INVALID")
+}
+
+// ensureLogChannel creates a private channel to store the files in when
+// LOG_CHANNEL isn't set, or when neither the userbot nor the main bot can
+// reach it. The new channel is remembered for the next runs.
+func (u *UserBotStruct) ensureLogChannel() error {
+	ctx := u.client.CreateContext()
+	if channelID := config.ValueOf.LogChannelID; channelID != 0 {
+		_, err := u.inputLogChannel(ctx)
+		if err == nil {
+			return nil
+		}
+		// a new channel breaks every existing link, so anything but the
+		// channel being gone for good, like a timeout, is returned as is
+		if !channelUnreachable(err) {
+			return err
+		}
+		if Bot != nil {
+			_, botErr := getChannel(ctx, Bot.API(), channelID)
+			if botErr == nil {
+				// only the userbot can't see it, the bots are fine
+				return err
+			}
+			if !channelUnreachable(botErr) {
+				return botErr
+			}
+		}
+		u.log.Warn("LOG_CHANNEL can't be reached, creating a new one", zap.Error(err))
+	}
+	about := "Files sent to the bot are stored here."
+	if Bot != nil {
+		about = fmt.Sprintf("Files sent to @%s are stored here.", Bot.Self.Username)
+	}
+	updates, err := u.client.API().ChannelsCreateChannel(ctx, &tg.ChannelsCreateChannelRequest{
+		Broadcast: true,
+		Title:     "File Stream Bot",
+		About:     about,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create log channel: %w", err)
+	}
+	var channel *tg.Channel
+	if withChats, ok := updates.(interface{ GetChats() []tg.ChatClass }); ok {
+		for _, chat := range withChats.GetChats() {
+			if c, ok := chat.(*tg.Channel); ok {
+				channel = c
+				break
+			}
+		}
+	}
+	if channel == nil {
+		return errors.New("created log channel not found in the updates")
+	}
+	u.client.PeerStorage.AddPeer(channel.ID, channel.AccessHash, storage.TypeChannel, "")
+	replaced := config.ValueOf.LogChannelID
+	// the userbot starts before the command handlers that read it, so it is
+	// safe to change here
+	config.ValueOf.LogChannelID = channel.ID
+	if err := database.SaveLogChannel(channel.ID, replaced); err != nil {
+		u.log.Error("Failed to save the log channel, it will be created again on the next run", zap.Error(err))
+	}
+	u.log.Info("Created log channel", zap.Int64("channelID", channel.ID))
+	return nil
+}
@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var botTokenPattern = regexp.MustCompile(`^\d+:[\w-]{30,}$`)
+
+// List returns a snapshot of the running workers.
+func (w *BotWorkers) List() []*Worker {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return slices.Clone(w.Bots)
+}
+
+// Find returns the running worker matching the ID or (@)username, nil if
+// there is none.
+func (w *BotWorkers) Find(query string) *Worker {
+	query = strings.TrimPrefix(query, "@")
+	id, err := strconv.Atoi(query)
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	for _, worker := range w.Bots {
+		if (err == nil && worker.ID == id) || strings.EqualFold(worker.Self.Username, query) {
+			return worker
+		}
+	}
+	return nil
+}
+
+// AddToken starts a worker for the token and remembers it for the next
+// runs.
+func (w *BotWorkers) AddToken(token string) (*Worker, error) {
+	worker, err := w.startToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.SaveWorkerToken(worker.token, worker.Self.Username, database.WorkerEnabled); err != nil {
+		w.log.Error("Failed to save worker token", zap.Error(err))
+	}
+	return worker, nil
+}
+
+func (w *BotWorkers) startToken(token string) (*Worker, error) {
+	token = strings.TrimSpace(token)
+	if !botTokenPattern.MatchString(token) {
+		return nil, errors.New("invalid bot token")
+	}
+	if w.findToken(token) != nil || token == config.ValueOf.BotToken {
+		return nil, errors.New("a worker with this token is already running")
+	}
+	if err := createSessionsDir(); err != nil {
+		return nil, err
+	}
+	worker, err := w.add(token)
+	if err != nil {
+		return nil, err
+	}
+	if UserBot.client != nil {
+		go UserBot.AddBotsAsAdmins()
+	}
+	return worker, nil
+}
+
+func (w *BotWorkers) findToken(token string) *Worker {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	for _, worker := range w.Bots {
+		if worker.token == token {
+			return worker
+		}
+	}
+	return nil
+}
+
+// Disable takes the worker out of the rotation and stops it once its
+// streams are drained. It can be enabled again later.
+func (w *BotWorkers) Disable(query string) (*Worker, error) {
+	return w.stop(query, database.WorkerDisabled)
+}
+
+// Remove stops the worker like Disable, but also forgets its token.
+func (w *BotWorkers) Remove(query string) (*Worker, error) {
+	worker, err := w.stop(query, database.WorkerRemoved)
+	if err == nil || worker != nil {
+		return worker, err
+	}
+	// disabled workers aren't running but can still be removed
+	stored, dbErr := database.GetWorkerTokenByUsername(strings.TrimPrefix(query, "@"))
+	if dbErr != nil || stored == nil {
+		return nil, err
+	}
+	return nil, database.SaveWorkerToken(stored.Token, stored.Username, database.WorkerRemoved)
+}
+
+// Enable starts a disabled worker again.
+func (w *BotWorkers) Enable(query string) (*Worker, error) {
+	stored, err := database.GetWorkerTokenByUsername(strings.TrimPrefix(query, "@"))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.State != database.WorkerDisabled {
+		return nil, fmt.Errorf("no disabled worker %s", query)
+	}
+	return w.AddToken(stored.Token)
+}
+
+func (w *BotWorkers) stop(query string, state database.WorkerState) (*Worker, error) {
+	worker := w.Find(query)
+	if worker == nil {
+		return nil, fmt.Errorf("no running worker %s", query)
+	}
+	if worker.token == "" {
+		return worker, errors.New("only worker bots can be stopped")
+	}
+	if err := database.SaveWorkerToken(worker.token, worker.Self.Username, state); err != nil {
+		w.log.Error("Failed to save worker token", zap.Error(err))
+	}
+	w.log.Sugar().Infof("Worker @%s %s", worker.Self.Username, state)
+	w.retire(worker)
+	return worker, nil
+}
+
+// retire takes the worker out of the rotation and drains it in the
+// background.
+func (w *BotWorkers) retire(worker *Worker) {
+	w.mut.Lock()
+	w.Bots = slices.DeleteFunc(w.Bots, func(bot *Worker) bool {
+		return bot == worker
+	})
+	w.mut.Unlock()
+	w.log.Sugar().Infof("Draining %d streams of worker @%s", worker.ActiveStreams(), worker.Self.Username)
+	go worker.drain(config.ValueOf.DrainTimeout)
+}
+
+// drain waits for the streams of the worker to finish, up to timeout, and
+// stops its client.
+func (w *Worker) drain(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for w.ActiveStreams() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+	}
+	if active := w.ActiveStreams(); active > 0 {
+		w.log.Sugar().Warnf("Stopping worker @%s with %d streams left", w.Self.Username, active)
+	}
+	w.Client().Stop()
+	w.log.Sugar().Infof("Worker @%s stopped", w.Self.Username)
+}
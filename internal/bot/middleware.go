@@ -1,20 +1,104 @@
 package bot
 
 import (
+	"EverythingSuckz/fsb/internal/metrics"
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
 	"time"
 
-	"github.com/gotd/contrib/middleware/floodwait"
 	"github.com/gotd/contrib/middleware/ratelimit"
+	"github.com/gotd/td/bin"
 	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
 
-func GetFloodMiddleware(log *zap.Logger) []telegram.Middleware {
-	waiter := floodwait.NewSimpleWaiter().WithMaxRetries(10)
+const floodWaitRetries = 10
+
+// minFloodWait is waited when Telegram asks for a flood wait of 0 seconds.
+var minFloodWait = time.Second
+
+// FloodWait is the flood wait deadline of a client, published by its flood
+// middleware so that busy clients can be skipped.
+type FloodWait struct {
+	until atomic.Int64
+	// worker labels the metrics, it is set once the client is logged in.
+	worker atomic.Pointer[Worker]
+}
+
+// Until returns the end of the current flood wait, the zero time if the
+// client never had to wait.
+func (f *FloodWait) Until() time.Time {
+	until := f.until.Load()
+	if until == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, until)
+}
+
+// Remaining returns how long the client still has to wait.
+func (f *FloodWait) Remaining() time.Duration {
+	return max(time.Until(f.Until()), 0)
+}
+
+func (f *FloodWait) extend(d time.Duration) {
+	until := time.Now().Add(d).UnixNano()
+	for {
+		current := f.until.Load()
+		if current >= until || f.until.CompareAndSwap(current, until) {
+			return
+		}
+	}
+}
+
+// Handle implements telegram.Middleware. Flood waits of file downloads are
+// returned right away, and further downloads fail without reaching Telegram
+// until the wait is over, so that streams can switch to another client.
+// Other requests wait and retry like floodwait.SimpleWaiter.
+func (f *FloodWait) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		_, download := input.(*tg.UploadGetFileRequest)
+		for retries := 0; ; retries++ {
+			if remaining := f.Remaining(); download && remaining > 0 {
+				seconds := int(math.Ceil(remaining.Seconds()))
+				return tgerr.New(420, fmt.Sprintf("FLOOD_WAIT_%d", seconds))
+			}
+			err := next.Invoke(ctx, input, output)
+			d, ok := tgerr.AsFloodWait(err)
+			if !ok {
+				return err
+			}
+			if d == 0 {
+				d = minFloodWait
+			}
+			f.extend(d)
+			if worker := f.worker.Load(); worker != nil {
+				metrics.FloodWaits.WithLabelValues(worker.labels()...).Inc()
+				metrics.FloodWaitSeconds.WithLabelValues(worker.labels()...).Add(d.Seconds())
+			}
+			if download {
+				return err
+			}
+			if retries >= floodWaitRetries {
+				return fmt.Errorf("flood wait retry limit exceeded: %w", err)
+			}
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+func GetFloodMiddleware(log *zap.Logger, floodWait *FloodWait) []telegram.Middleware {
 	ratelimiter := ratelimit.New(rate.Every(time.Millisecond*100), 5)
 	return []telegram.Middleware{
-		waiter,
+		floodWait,
 		ratelimiter,
 	}
 }
@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// fakeInvoker answers every request with the next error of errs, nil once
+// they are used up.
+type fakeInvoker struct {
+	errs  []error
+	calls int
+}
+
+func (i *fakeInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	i.calls++
+	if len(i.errs) == 0 {
+		return nil
+	}
+	err := i.errs[0]
+	i.errs = i.errs[1:]
+	return err
+}
+
+func floodWaitError(seconds int) error {
+	return tgerr.New(420, "FLOOD_WAIT_"+strconv.Itoa(seconds))
+}
+
+func shortenFloodWaits(t *testing.T) {
+	t.Helper()
+	previous := minFloodWait
+	minFloodWait = time.Millisecond
+	t.Cleanup(func() {
+		minFloodWait = previous
+	})
+}
+
+func TestFloodWaitExtend(t *testing.T) {
+	var f FloodWait
+	if !f.Until().IsZero() || f.Remaining() != 0 {
+		t.Fatalf("new FloodWait is waiting until %v", f.Until())
+	}
+	f.extend(time.Hour)
+	until := f.Until()
+	if remaining := f.Remaining(); remaining <= 59*time.Minute || remaining > time.Hour {
+		t.Errorf("Remaining() = %v, want about an hour", remaining)
+	}
+	// a shorter wait reported meanwhile must not end the longer one early
+	f.extend(time.Minute)
+	if !f.Until().Equal(until) {
+		t.Errorf("extend() moved the deadline from %v to %v", until, f.Until())
+	}
+	f.extend(2 * time.Hour)
+	if !f.Until().After(until) {
+		t.Errorf("extend() didn't move the deadline to a later wait")
+	}
+}
+
+func TestFloodWaitDownloadFailsFast(t *testing.T) {
+	var f FloodWait
+	f.extend(time.Minute)
+	invoker := &fakeInvoker{}
+	err := f.Handle(invoker)(context.Background(), &tg.UploadGetFileRequest{}, nil)
+	d, ok := tgerr.AsFloodWait(err)
+	if !ok {
+		t.Fatalf("Handle() = %v, want a FLOOD_WAIT error", err)
+	}
+	if d <= 59*time.Second || d > time.Minute {
+		t.Errorf("FLOOD_WAIT of %v, want the remaining minute", d)
+	}
+	if invoker.calls != 0 {
+		t.Errorf("the download reached Telegram %d times during the wait", invoker.calls)
+	}
+
+	// other requests are still sent
+	if err := f.Handle(invoker)(context.Background(), &tg.HelpGetConfigRequest{}, nil); err != nil {
+		t.Errorf("Handle() = %v", err)
+	}
+	if invoker.calls != 1 {
+		t.Errorf("invoker called %d times, want 1", invoker.calls)
+	}
+}
+
+func TestFloodWaitDownloadReturnsFloodWait(t *testing.T) {
+	var f FloodWait
+	invoker := &fakeInvoker{errs: []error{floodWaitError(30)}}
+	err := f.Handle(invoker)(context.Background(), &tg.UploadGetFileRequest{}, nil)
+	if _, ok := tgerr.AsFloodWait(err); !ok {
+		t.Fatalf("Handle() = %v, want the FLOOD_WAIT error", err)
+	}
+	if invoker.calls != 1 {
+		t.Errorf("invoker called %d times, downloads must not be retried", invoker.calls)
+	}
+	if remaining := f.Remaining(); remaining <= 29*time.Second || remaining > 30*time.Second {
+		t.Errorf("Remaining() = %v, want the 30 seconds of the error", remaining)
+	}
+}
+
+func TestFloodWaitRetries(t *testing.T) {
+	shortenFloodWaits(t)
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"no wait", nil, 1, false},
+		{"other error", []error{errors.New("boom")}, 1, true},
+		{"waits then succeeds", []error{floodWaitError(0), floodWaitError(0)}, 3, false},
+		{"retry limit", repeat(floodWaitError(0), floodWaitRetries+5), floodWaitRetries + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f FloodWait
+			invoker := &fakeInvoker{errs: tt.errs}
+			err := f.Handle(invoker)(context.Background(), &tg.HelpGetConfigRequest{}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Handle() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if invoker.calls != tt.wantCalls {
+				t.Errorf("invoker called %d times, want %d", invoker.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFloodWaitCanceled(t *testing.T) {
+	var f FloodWait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	invoker := &fakeInvoker{errs: []error{floodWaitError(60)}}
+	err := f.Handle(invoker)(ctx, &tg.HelpGetConfigRequest{}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Handle() = %v, want the context error", err)
+	}
+}
+
+func repeat(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Strategy picks the worker for the next request. Candidates are rotated
+// so that they start right after the previously picked worker, strategies
+// should prefer the first candidate on ties to keep the load spread.
+// Strategies are called with BotWorkers.mut held.
+type Strategy func(candidates []*Worker) *Worker
+
+var strategies = map[string]Strategy{
+	"round-robin":        roundRobin,
+	"least-active":       leastActive,
+	"weighted":           weighted,
+	"least-recent-error": leastRecentError,
+}
+
+// GetStrategy returns the selection strategy registered under name.
+func GetStrategy(name string) (Strategy, error) {
+	strategy, ok := strategies[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown worker strategy %q, expected one of %s", name, strings.Join(StrategyNames(), ", "))
+	}
+	return strategy, nil
+}
+
+func StrategyNames() []string {
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func roundRobin(candidates []*Worker) *Worker {
+	return candidates[0]
+}
+
+// leastActive picks the worker serving the fewest streams.
+func leastActive(candidates []*Worker) *Worker {
+	best := candidates[0]
+	for _, worker := range candidates[1:] {
+		if worker.ActiveStreams() < best.ActiveStreams() {
+			best = worker
+		}
+	}
+	return best
+}
+
+// weighted is the smooth weighted round-robin used by nginx, every worker
+// gets picked in proportion to its weight without bursts.
+func weighted(candidates []*Worker) *Worker {
+	var best *Worker
+	total := 0
+	for _, worker := range candidates {
+		worker.currentWeight += worker.Weight
+		total += worker.Weight
+		if best == nil || worker.currentWeight > best.currentWeight {
+			best = worker
+		}
+	}
+	best.currentWeight -= total
+	return best
+}
+
+// leastRecentError picks the worker whose last failure is the oldest,
+// workers that never failed come first.
+func leastRecentError(candidates []*Worker) *Worker {
+	best := candidates[0]
+	for _, worker := range candidates[1:] {
+		if worker.LastError().Before(best.LastError()) {
+			best = worker
+		}
+	}
+	return best
+}
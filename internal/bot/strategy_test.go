@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestWorkers(n int) []*Worker {
+	workers := make([]*Worker, n)
+	for i := range workers {
+		workers[i] = &Worker{ID: i + 1, Weight: 1}
+	}
+	return workers
+}
+
+func TestRoundRobin(t *testing.T) {
+	workers := newTestWorkers(3)
+	if got := roundRobin(workers); got != workers[0] {
+		t.Errorf("roundRobin() = worker %d, want 1", got.ID)
+	}
+}
+
+func TestLeastActive(t *testing.T) {
+	tests := []struct {
+		name   string
+		active []int64
+		want   int
+	}{
+		{"fewest streams", []int64{3, 1, 2}, 2},
+		{"idle last", []int64{2, 1, 0}, 3},
+		{"tie goes to the first", []int64{1, 0, 0}, 2},
+		{"all idle", []int64{0, 0, 0}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workers := newTestWorkers(len(tt.active))
+			for i, active := range tt.active {
+				workers[i].activeStreams.Store(active)
+			}
+			if got := leastActive(workers); got.ID != tt.want {
+				t.Errorf("leastActive() = worker %d, want %d", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		want    []int
+	}{
+		// the sequence nginx documents for weights 5/1/1 is a a b a c a a
+		{"5/1/1", []int{5, 1, 1}, []int{1, 1, 2, 1, 3, 1, 1}},
+		{"3/1/1", []int{3, 1, 1}, []int{1, 2, 1, 3, 1}},
+		{"equal", []int{1, 1, 1}, []int{1, 2, 3, 1, 2, 3}},
+		{"2/1", []int{2, 1}, []int{1, 2, 1, 1, 2, 1}},
+		{"single", []int{4}, []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workers := newTestWorkers(len(tt.weights))
+			for i, weight := range tt.weights {
+				workers[i].Weight = weight
+			}
+			for i, want := range tt.want {
+				if got := weighted(workers); got.ID != want {
+					t.Fatalf("pick %d: weighted() = worker %d, want %d", i+1, got.ID, want)
+				}
+			}
+			// every sequence covers whole cycles, which leave no weight behind
+			for _, worker := range workers {
+				if worker.currentWeight != 0 {
+					t.Errorf("worker %d ends the cycle with weight %d, want 0", worker.ID, worker.currentWeight)
+				}
+			}
+		})
+	}
+}
+
+func TestLeastRecentError(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		// failed is how long ago each worker failed, 0 if it never did
+		failed []time.Duration
+		want   int
+	}{
+		{"oldest failure", []time.Duration{time.Minute, time.Hour, time.Second}, 2},
+		{"never failed", []time.Duration{time.Hour, 0, time.Minute}, 2},
+		{"never failed last", []time.Duration{time.Hour, time.Minute, 0}, 3},
+		{"tie goes to the first", []time.Duration{time.Minute, 0, 0}, 2},
+		{"none failed", []time.Duration{0, 0, 0}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workers := newTestWorkers(len(tt.failed))
+			for i, ago := range tt.failed {
+				if ago != 0 {
+					workers[i].lastError.Store(now.Add(-ago).UnixNano())
+				}
+			}
+			if got := leastRecentError(workers); got.ID != tt.want {
+				t.Errorf("leastRecentError() = worker %d, want %d", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetStrategy(t *testing.T) {
+	for _, name := range StrategyNames() {
+		if _, err := GetStrategy(name); err != nil {
+			t.Errorf("GetStrategy(%q) error = %v", name, err)
+		}
+	}
+	if _, err := GetStrategy("Least-Active"); err != nil {
+		t.Errorf("strategy names must be case insensitive: %v", err)
+	}
+	if _, err := GetStrategy("random"); err == nil {
+		t.Errorf("GetStrategy() accepted an unknown strategy")
+	}
+}
@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"os"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const tokenFileInterval = 10 * time.Second
+
+// tokenFile keeps the tokens last read from MULTI_TOKEN_TXT_FILE, so that
+// changes to the file can be applied to the running workers.
+var tokenFile = &tokenFileWatcher{}
+
+type tokenFileWatcher struct {
+	tokens  []string
+	modTime time.Time
+	size    int64
+}
+
+// load reads the tokens from the file, it returns false if the file is
+// unchanged since the last read or can't be read.
+func (t *tokenFileWatcher) load() (bool, error) {
+	path := config.ValueOf.MultiTokenTxtFile
+	if path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(t.modTime) && info.Size() == t.size {
+		return false, nil
+	}
+	tokens, err := config.ReadTokenFile(path)
+	if err != nil {
+		return false, err
+	}
+	t.tokens = tokens
+	t.modTime = info.ModTime()
+	t.size = info.Size()
+	return true, nil
+}
+
+// WatchTokenFile polls MULTI_TOKEN_TXT_FILE for changes in the background.
+// Workers are started for the tokens added to the file, and drained and
+// stopped for the tokens removed from it.
+func WatchTokenFile(log *zap.Logger) {
+	path := config.ValueOf.MultiTokenTxtFile
+	if path == "" {
+		return
+	}
+	log = log.Named("TokenFile")
+	go func() {
+		ticker := time.NewTicker(tokenFileInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if Workers.stopped.Load() {
+				return
+			}
+			previous := tokenFile.tokens
+			// errors were reported at startup, the file may come back
+			if changed, _ := tokenFile.load(); !changed {
+				continue
+			}
+			Workers.applyTokenFile(log, previous, tokenFile.tokens)
+		}
+	}()
+	log.Sugar().Infof("Watching %s for token changes", path)
+}
+
+func (w *BotWorkers) applyTokenFile(log *zap.Logger, previous []string, current []string) {
+	states := make(map[string]database.WorkerState)
+	stored, err := database.GetWorkerTokens()
+	if err != nil {
+		log.Error("Failed to load worker tokens from the database", zap.Error(err))
+	}
+	for _, token := range stored {
+		states[token.Token] = token.State
+	}
+	removed, added := tokenFileChanges(previous, current, states)
+	for _, token := range removed {
+		if worker := w.findToken(token); worker != nil {
+			log.Sugar().Infof("Token of worker @%s removed from the file", worker.Self.Username)
+			w.retire(worker)
+		}
+	}
+	for _, token := range added {
+		if state, ok := states[token]; ok && state != database.WorkerEnabled {
+			log.Sugar().Infof("Skipping %s token from the file", state)
+			continue
+		}
+		if w.findToken(token) != nil {
+			continue
+		}
+		w.startFileToken(log, token)
+	}
+}
+
+// tokenFileChanges compares two reads of the token file. Removed tokens
+// that are also set in the environment or enabled in the database keep
+// their workers, and BOT_TOKEN is never added since the main bot runs with
+// it.
+func tokenFileChanges(previous []string, current []string, states map[string]database.WorkerState) (removed []string, added []string) {
+	for _, token := range previous {
+		if slices.Contains(current, token) ||
+			slices.Contains(config.ValueOf.MultiTokens, token) ||
+			states[token] == database.WorkerEnabled {
+			continue
+		}
+		removed = append(removed, token)
+	}
+	for _, token := range current {
+		if slices.Contains(previous, token) || token == config.ValueOf.BotToken {
+			continue
+		}
+		added = append(added, token)
+	}
+	return removed, added
+}
+
+func (w *BotWorkers) startFileToken(log *zap.Logger, token string) {
+	done := make(chan error, 1)
+	go func() {
+		worker, err := w.startToken(token)
+		if err == nil {
+			log.Sugar().Infof("Started worker @%s from the file", worker.Self.Username)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Error("Failed to start worker from the file", zap.Error(err))
+		}
+	case <-time.After(restartTimeout):
+		log.Error("Timed out starting worker from the file")
+	}
+}
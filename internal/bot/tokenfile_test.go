@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestTokenFileChanges(t *testing.T) {
+	previous := *config.ValueOf
+	t.Cleanup(func() {
+		*config.ValueOf = previous
+	})
+	config.ValueOf.BotToken = "100:main"
+	config.ValueOf.MultiTokens = []string{"200:env"}
+
+	tests := []struct {
+		name        string
+		previous    []string
+		current     []string
+		states      map[string]database.WorkerState
+		wantRemoved []string
+		wantAdded   []string
+	}{
+		{
+			name:      "first read",
+			current:   []string{"300:a", "400:b"},
+			wantAdded: []string{"300:a", "400:b"},
+		},
+		{
+			name:     "unchanged",
+			previous: []string{"300:a", "400:b"},
+			current:  []string{"400:b", "300:a"},
+		},
+		{
+			name:        "added and removed",
+			previous:    []string{"300:a", "400:b"},
+			current:     []string{"400:b", "500:c"},
+			wantRemoved: []string{"300:a"},
+			wantAdded:   []string{"500:c"},
+		},
+		{
+			name:     "removed but set in the environment",
+			previous: []string{"200:env", "300:a"},
+			current:  []string{"300:a"},
+		},
+		{
+			name:     "removed but enabled in the database",
+			previous: []string{"300:a", "400:b"},
+			current:  []string{"300:a"},
+			states:   map[string]database.WorkerState{"400:b": database.WorkerEnabled},
+		},
+		{
+			name:        "removed and disabled in the database",
+			previous:    []string{"300:a", "400:b"},
+			current:     []string{"300:a"},
+			states:      map[string]database.WorkerState{"400:b": database.WorkerDisabled},
+			wantRemoved: []string{"400:b"},
+		},
+		{
+			name:      "BOT_TOKEN is skipped",
+			current:   []string{"100:main", "300:a"},
+			wantAdded: []string{"300:a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed, added := tokenFileChanges(tt.previous, tt.current, tt.states)
+			if !slices.Equal(removed, tt.wantRemoved) {
+				t.Errorf("removed = %q, want %q", removed, tt.wantRemoved)
+			}
+			if !slices.Equal(added, tt.wantAdded) {
+				t.Errorf("added = %q, want %q", added, tt.wantAdded)
+			}
+		})
+	}
+}
+
+func TestTokenFileLoad(t *testing.T) {
+	previous := *config.ValueOf
+	t.Cleanup(func() {
+		*config.ValueOf = previous
+	})
+	path := filepath.Join(t.TempDir(), "tokens.txt")
+	config.ValueOf.MultiTokenTxtFile = path
+	watcher := &tokenFileWatcher{}
+	load := func() bool {
+		t.Helper()
+		changed, err := watcher.load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return changed
+	}
+
+	if changed, err := watcher.load(); changed || err == nil {
+		t.Errorf("load() of a missing file = %v, %v, want an error", changed, err)
+	}
+	if err := os.WriteFile(path, []byte("300:a\n400:b\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if !load() || !slices.Equal(watcher.tokens, []string{"300:a", "400:b"}) {
+		t.Fatalf("load() = %q, want the tokens of the file", watcher.tokens)
+	}
+	if load() {
+		t.Errorf("load() of an unchanged file reported a change")
+	}
+	if err := os.WriteFile(path, []byte("300:a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// the size alone tells the change apart, whatever the clock resolution
+	if !load() || !slices.Equal(watcher.tokens, []string{"300:a"}) {
+		t.Errorf("load() = %q, want the new tokens of the file", watcher.tokens)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if !load() {
+		t.Errorf("load() of a touched file reported no change")
+	}
+}
+
+func TestWorkerTokens(t *testing.T) {
+	previous := *config.ValueOf
+	previousTokens := tokenFile.tokens
+	t.Cleanup(func() {
+		*config.ValueOf = previous
+		tokenFile.tokens = previousTokens
+	})
+	config.ValueOf.DatabasePath = filepath.Join(t.TempDir(), "fsb.db")
+	if err := database.Init(zap.NewNop()); err != nil {
+		t.Fatal(err)
+	}
+	database.SaveWorkerToken("500:db", "dbbot", database.WorkerEnabled)
+	database.SaveWorkerToken("600:off", "offbot", database.WorkerDisabled)
+	database.SaveWorkerToken("700:gone", "gonebot", database.WorkerRemoved)
+	config.ValueOf.BotToken = "100:main"
+	config.ValueOf.MultiTokens = []string{"200:env", "100:main", "700:gone"}
+	tokenFile.tokens = []string{"300:file", "100:main", "600:off", "200:env"}
+
+	want := []string{"200:env", "300:file", "500:db"}
+	if got := workerTokens(); !slices.Equal(got, want) {
+		t.Errorf("workerTokens() = %q, want %q", got, want)
+	}
+}
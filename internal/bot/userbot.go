@@ -13,6 +13,9 @@ import (
 type UserBotStruct struct {
 	log    *zap.Logger
 	client *gotgproto.Client
+	// worker streams with the userbot client, in the rotation with
+	// USERBOT_WORKER and as the last resort otherwise.
+	worker *Worker
 }
 
 var UserBot *UserBotStruct = &UserBotStruct{}
@@ -24,6 +27,7 @@ func StartUserBot(l *zap.Logger) {
 		return
 	}
 	log.Sugar().Infoln("Starting userbot")
+	floodWait := &FloodWait{}
 	client, err := gotgproto.NewClient(
 		int(config.ValueOf.APIID),
 		config.ValueOf.APIHash,
@@ -31,6 +35,7 @@ func StartUserBot(l *zap.Logger) {
 		&gotgproto.ClientOpts{
 			Session:          sessionMaker.PyrogramSession(config.ValueOf.UserSession),
 			DisableCopyright: true,
+			Middlewares:      GetFloodMiddleware(log, floodWait),
 		},
 	)
 	if err != nil {
@@ -40,32 +45,62 @@ func StartUserBot(l *zap.Logger) {
 	UserBot.log = log
 	UserBot.client = client
 	log.Info("Userbot started", zap.String("username", client.Self.Username), zap.String("FirstName", client.Self.FirstName), zap.String("LastName", client.Self.LastName))
+	UserBot.worker = Workers.addUserBot(client, floodWait)
+	if err := UserBot.ensureLogChannel(); err != nil {
+		log.Error("Failed to provide a log channel", zap.Error(err))
+		return
+	}
 	if err := UserBot.AddBotsAsAdmins(); err != nil {
 		log.Error("Failed to add bots as admins", zap.Error(err))
 		return
 	}
 }
 
+// addUserBot creates the worker of the userbot client and puts it in the
+// rotation if USERBOT_WORKER is set.
+func (w *BotWorkers) addUserBot(client *gotgproto.Client, floodWait *FloodWait) *Worker {
+	w.incStarting()
+	worker := &Worker{
+		ID:        w.starting,
+		Self:      client.Self,
+		Weight:    config.ValueOf.UserBotWeight,
+		floodWait: floodWait,
+		log:       w.log,
+	}
+	worker.client.Store(client)
+	floodWait.worker.Store(worker)
+	if !config.ValueOf.UserBotWorker {
+		w.log.Sugar().Infof("Userbot loaded with ID %d as fallback", worker.ID)
+		return worker
+	}
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	w.Bots = append(w.Bots, worker)
+	w.log.Sugar().Infof("Userbot loaded with ID %d", worker.ID)
+	return worker
+}
+
+// Stop stops the userbot client, if it is running.
+func (u *UserBotStruct) Stop() {
+	if u.client != nil {
+		u.client.Stop()
+	}
+}
+
+// GetFallbackWorker returns the worker of the userbot, nil if it isn't
+// running.
+func GetFallbackWorker() *Worker {
+	return UserBot.worker
+}
+
 func (u *UserBotStruct) AddBotsAsAdmins() error {
 	u.log.Info("Preparing to add bots as admins")
 	ctx := u.client.CreateContext()
-	channel := config.ValueOf.LogChannelID
-	channelInfos, err := u.client.API().ChannelsGetChannels(
-		ctx,
-		[]tg.InputChannelClass{
-			&tg.InputChannel{
-				ChannelID: channel,
-			},
-		},
-	)
+	inputChannel, err := u.inputLogChannel(ctx)
 	if err != nil {
 		u.log.Error("Failed to get channel info", zap.Error(err))
 		return errors.New("failed to get channel info")
 	}
-	if len(channelInfos.GetChats()) == 0 {
-		return errors.New("no channels found")
-	}
-	inputChannel := channelInfos.GetChats()[0].(*tg.Channel).AsInput()
 	currentAdmins := []int64{}
 	admins, err := u.client.API().ChannelsGetParticipants(ctx, &tg.ChannelsGetParticipantsRequest{
 		Channel: inputChannel,
@@ -82,7 +117,10 @@ func (u *UserBotStruct) AddBotsAsAdmins() error {
 			currentAdmins = append(currentAdmins, user.UserID)
 		}
 	}
-	for _, bot := range Workers.Bots {
+	for _, bot := range Workers.List() {
+		if !bot.Self.Bot {
+			continue
+		}
 		isAdmin := false
 		for _, admin := range currentAdmins {
 			if admin == bot.Self.ID {
@@ -97,14 +135,18 @@ func (u *UserBotStruct) AddBotsAsAdmins() error {
 		botInfo, err := ctx.ResolveUsername(bot.Self.Username)
 		if err != nil {
 			u.log.Warn(err.Error())
+			continue
 		}
 		_, err = u.client.API().ChannelsEditAdmin(
 			u.client.CreateContext().Context,
 			&tg.ChannelsEditAdminRequest{
 				Channel: inputChannel,
 				UserID:  botInfo.GetInputUser(),
+				// the bots forward the files to the channel, and delete
+				// them again when their links are revoked
 				AdminRights: tg.ChatAdminRights{
-					PostMessages: true,
+					PostMessages:   true,
+					DeleteMessages: true,
 				},
 				Rank: "admin",
 			},
@@ -112,6 +154,7 @@ func (u *UserBotStruct) AddBotsAsAdmins() error {
 		if err != nil {
 			u.log.Sugar().Warnf("Failed to add @%s as admin", bot.Self.Username)
 			u.log.Warn(err.Error())
+			continue
 		}
 		u.log.Sugar().Infof("Added @%s as admin", bot.Self.Username)
 	}
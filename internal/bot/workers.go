@@ -2,10 +2,16 @@ package bot
 
 import (
 	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/metrics"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,20 +24,93 @@ import (
 )
 
 type Worker struct {
-	ID     int
-	Client *gotgproto.Client
-	Self   *tg.User
-	log    *zap.Logger
+	ID   int
+	Self *tg.User
+	// Weight is the share of requests the worker gets with the weighted strategy.
+	Weight        int
+	currentWeight int
+	activeStreams atomic.Int64
+	errors        atomic.Int64
+	lastError     atomic.Int64
+	client        atomic.Pointer[gotgproto.Client]
+	floodWait     *FloodWait
+	// token is empty for the main bot, which can't be restarted on its own.
+	token string
+	health
+	log *zap.Logger
+}
+
+// Client returns the current client of the worker, it is replaced when the
+// worker gets restarted.
+func (w *Worker) Client() *gotgproto.Client {
+	return w.client.Load()
 }
 
 func (w *Worker) String() string {
 	return fmt.Sprintf("{Worker (%d|@%s)}", w.ID, w.Self.Username)
 }
 
+// StreamStarted and StreamFinished track the streams the worker serves.
+func (w *Worker) StreamStarted() {
+	w.activeStreams.Add(1)
+	metrics.WorkerActiveStreams.WithLabelValues(w.labels()...).Inc()
+}
+
+func (w *Worker) StreamFinished() {
+	w.activeStreams.Add(-1)
+	metrics.WorkerActiveStreams.WithLabelValues(w.labels()...).Dec()
+}
+
+func (w *Worker) ActiveStreams() int64 {
+	return w.activeStreams.Load()
+}
+
+// FloodWait returns how long the worker has to wait before it may download
+// again.
+func (w *Worker) FloodWait() time.Duration {
+	return w.floodWait.Remaining()
+}
+
+// ObserveDownload records the latency and the outcome of an upload.getFile
+// request of the worker.
+func (w *Worker) ObserveDownload(d time.Duration, err error) {
+	metrics.DownloadDuration.WithLabelValues(w.labels()...).Observe(d.Seconds())
+	if err != nil && !errors.Is(err, context.Canceled) {
+		metrics.DownloadErrors.WithLabelValues(w.labels()...).Inc()
+	}
+}
+
+// labels identify the worker in metrics.
+func (w *Worker) labels() []string {
+	return []string{strconv.Itoa(w.ID), w.Self.Username}
+}
+
+// RecordError notes a failed request of the worker.
+func (w *Worker) RecordError() {
+	w.errors.Add(1)
+	w.lastError.Store(time.Now().UnixNano())
+}
+
+func (w *Worker) Errors() int64 {
+	return w.errors.Load()
+}
+
+// LastError returns the time of the last failed request, the zero time if
+// there was none.
+func (w *Worker) LastError() time.Time {
+	lastError := w.lastError.Load()
+	if lastError == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, lastError)
+}
+
 type BotWorkers struct {
 	Bots     []*Worker
 	starting int
 	index    int
+	strategy Strategy
+	stopped  atomic.Bool
 	mut      sync.Mutex
 	log      *zap.Logger
 }
@@ -43,6 +122,20 @@ var Workers *BotWorkers = &BotWorkers{
 
 func (w *BotWorkers) Init(log *zap.Logger) {
 	w.log = log.Named("Workers")
+	strategy, err := GetStrategy(config.ValueOf.WorkerStrategy)
+	if err != nil {
+		w.log.Warn("Falling back to round-robin", zap.Error(err))
+		strategy = roundRobin
+	}
+	w.strategy = strategy
+}
+
+// weightOf returns the configured weight of the bot, 1 by default.
+func weightOf(self *tg.User) int {
+	if weight, ok := config.ValueOf.WorkerWeights[strings.ToLower(self.Username)]; ok && weight > 0 {
+		return weight
+	}
+	return 1
 }
 
 func (w *BotWorkers) AddDefaultClient(client *gotgproto.Client, self *tg.User) {
@@ -50,12 +143,16 @@ func (w *BotWorkers) AddDefaultClient(client *gotgproto.Client, self *tg.User) {
 		w.Bots = make([]*Worker, 0)
 	}
 	w.incStarting()
-	w.Bots = append(w.Bots, &Worker{
-		Client: client,
-		ID:     w.starting,
-		Self:   self,
-		log:    w.log,
-	})
+	worker := &Worker{
+		ID:        w.starting,
+		Self:      self,
+		Weight:    weightOf(self),
+		floodWait: mainFloodWait,
+		log:       w.log,
+	}
+	worker.client.Store(client)
+	worker.floodWait.worker.Store(worker)
+	w.Bots = append(w.Bots, worker)
 	w.log.Sugar().Info("Default bot loaded")
 }
 
@@ -66,52 +163,126 @@ func (w *BotWorkers) incStarting() {
 }
 
 func (w *BotWorkers) Add(token string) (err error) {
+	_, err = w.add(token)
+	return err
+}
+
+func (w *BotWorkers) add(token string) (*Worker, error) {
 	w.incStarting()
 	var botID int = w.starting
-	client, err := startWorker(w.log, token, botID)
+	floodWait := &FloodWait{}
+	client, err := startWorker(w.log, token, botID, floodWait)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	w.log.Sugar().Infof("Bot @%s loaded with ID %d", client.Self.Username, botID)
-	w.Bots = append(w.Bots, &Worker{
-		Client: client,
-		ID:     botID,
-		Self:   client.Self,
-		log:    w.log,
-	})
-	return nil
+	worker := &Worker{
+		ID:        botID,
+		Self:      client.Self,
+		Weight:    weightOf(client.Self),
+		token:     token,
+		floodWait: floodWait,
+		log:       w.log,
+	}
+	worker.client.Store(client)
+	floodWait.worker.Store(worker)
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	w.Bots = append(w.Bots, worker)
+	return worker, nil
+}
+
+// next picks a worker with the configured strategy, skipping quarantined
+// and flood waiting workers and the IDs in exclude. It returns nil if no worker is left.
+// Must be called with mut held.
+func (w *BotWorkers) next(exclude map[int]bool) *Worker {
+	candidates := make([]*Worker, 0, len(w.Bots))
+	for i := 1; i <= len(w.Bots); i++ {
+		worker := w.Bots[(w.index+i)%len(w.Bots)]
+		if !exclude[worker.ID] && !worker.Quarantined() && worker.FloodWait() == 0 {
+			candidates = append(candidates, worker)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	worker := w.strategy(candidates)
+	for i, bot := range w.Bots {
+		if bot == worker {
+			w.index = i
+			break
+		}
+	}
+	return worker
 }
 
 func GetNextWorker() *Worker {
 	Workers.mut.Lock()
 	defer Workers.mut.Unlock()
-	index := (Workers.index + 1) % len(Workers.Bots)
-	Workers.index = index
-	worker := Workers.Bots[index]
+	worker := Workers.next(nil)
+	if worker == nil {
+		// every worker is quarantined or waiting, trying one beats failing
+		// right away
+		Workers.index = (Workers.index + 1) % len(Workers.Bots)
+		worker = Workers.Bots[Workers.index]
+	}
 	Workers.log.Sugar().Debugf("Using worker %d", worker.ID)
 	return worker
 }
 
+// GetFailoverWorker returns the next worker whose ID is not in exclude. The
+// userbot is the last resort once every bot is excluded, nil is returned
+// if it is excluded too.
+func GetFailoverWorker(exclude map[int]bool) *Worker {
+	Workers.mut.Lock()
+	defer Workers.mut.Unlock()
+	worker := Workers.next(exclude)
+	if fallback := GetFallbackWorker(); worker == nil && fallback != nil &&
+		!exclude[fallback.ID] && !fallback.Quarantined() && fallback.FloodWait() == 0 {
+		worker = fallback
+	}
+	if worker != nil {
+		Workers.log.Sugar().Debugf("Failing over to worker %d", worker.ID)
+	}
+	return worker
+}
+
+// GetStripeWorkers returns every healthy worker that isn't flood waiting, starting with first, so
+// that the chunks of a single stream can be spread across all of them.
+func GetStripeWorkers(first *Worker) []*Worker {
+	Workers.mut.Lock()
+	defer Workers.mut.Unlock()
+	workers := []*Worker{first}
+	for _, worker := range Workers.Bots {
+		if worker != first && !worker.Quarantined() && worker.FloodWait() == 0 {
+			workers = append(workers, worker)
+		}
+	}
+	return workers
+}
+
 func StartWorkers(log *zap.Logger) (*BotWorkers, error) {
 	Workers.Init(log)
 
-	if len(config.ValueOf.MultiTokens) == 0 {
+	if changed, err := tokenFile.load(); err != nil {
+		Workers.log.Error("Failed to read MULTI_TOKEN_TXT_FILE", zap.Error(err))
+	} else if changed {
+		Workers.log.Sugar().Infof("Found %d worker tokens in %s", len(tokenFile.tokens), config.ValueOf.MultiTokenTxtFile)
+	}
+	tokens := workerTokens()
+	if len(tokens) == 0 {
 		Workers.log.Sugar().Info("No worker bot tokens provided, skipping worker initialization")
 		return Workers, nil
 	}
 	Workers.log.Sugar().Info("Starting")
-	if config.ValueOf.UseSessionFile {
-		Workers.log.Sugar().Info("Using session file for workers")
-		newpath := filepath.Join(".", "sessions")
-		if err := os.MkdirAll(newpath, os.ModePerm); err != nil {
-			Workers.log.Error("Failed to create sessions directory", zap.Error(err))
-			return nil, err
-		}
+	if err := createSessionsDir(); err != nil {
+		Workers.log.Error("Failed to create sessions directory", zap.Error(err))
+		return nil, err
 	}
 
 	var wg sync.WaitGroup
 	var successfulStarts int32
-	totalBots := len(config.ValueOf.MultiTokens)
+	totalBots := len(tokens)
 
 	for i := 0; i < totalBots; i++ {
 		wg.Add(1)
@@ -123,7 +294,7 @@ func StartWorkers(log *zap.Logger) (*BotWorkers, error) {
 
 			done := make(chan error, 1)
 			go func() {
-				err := Workers.Add(config.ValueOf.MultiTokens[i])
+				err := Workers.Add(tokens[i])
 				done <- err
 			}()
 
@@ -145,12 +316,67 @@ func StartWorkers(log *zap.Logger) (*BotWorkers, error) {
 	return Workers, nil
 }
 
-func startWorker(l *zap.Logger, botToken string, index int) (*gotgproto.Client, error) {
+// Stop stops the clients of the worker bots on shutdown. The main bot and
+// the userbot are stopped on their own.
+func (w *BotWorkers) Stop() {
+	w.stopped.Store(true)
+	for _, worker := range w.List() {
+		if worker.token != "" {
+			worker.Client().Stop()
+		}
+	}
+}
+
+func createSessionsDir() error {
+	if !config.ValueOf.UseSessionFile {
+		return nil
+	}
+	Workers.log.Sugar().Info("Using session file for workers")
+	newpath := filepath.Join(".", "sessions")
+	return os.MkdirAll(newpath, os.ModePerm)
+}
+
+// workerTokens merges the tokens from the environment and the token file
+// with the ones managed at runtime, leaving out the ones that were disabled
+// or removed.
+func workerTokens() []string {
+	stored, err := database.GetWorkerTokens()
+	if err != nil {
+		Workers.log.Error("Failed to load worker tokens from the database", zap.Error(err))
+	}
+	skip := make(map[string]bool)
+	runtimeTokens := make([]string, 0, len(stored))
+	for _, token := range stored {
+		if token.State == database.WorkerEnabled {
+			runtimeTokens = append(runtimeTokens, token.Token)
+		} else {
+			skip[token.Token] = true
+		}
+	}
+	all := append(slices.Clone(config.ValueOf.MultiTokens), tokenFile.tokens...)
+	all = append(all, runtimeTokens...)
+	tokens := make([]string, 0, len(all))
+	// the main bot already runs with BOT_TOKEN
+	skip[config.ValueOf.BotToken] = true
+	for _, token := range all {
+		if !skip[token] {
+			tokens = append(tokens, token)
+			skip[token] = true
+		}
+	}
+	return tokens
+}
+
+func startWorker(l *zap.Logger, botToken string, index int, floodWait *FloodWait) (*gotgproto.Client, error) {
 	log := l.Named("Worker").Sugar()
 	log.Infof("Starting worker with index - %d", index)
 	var sessionType sessionMaker.SessionConstructor
 	if config.ValueOf.UseSessionFile {
-		sessionType = sessionMaker.SqlSession(sqlite.Open(fmt.Sprintf("sessions/worker-%d.session", index)))
+		// sessions are named after the bot, not the start order, which
+		// changes as tokens are added and removed. A session of another
+		// bot would be used as is, without logging in with the token.
+		botID, _, _ := strings.Cut(botToken, ":")
+		sessionType = sessionMaker.SqlSession(sqlite.Open(fmt.Sprintf("sessions/worker-%s.session", botID)))
 	} else {
 		sessionType = sessionMaker.SimpleSession()
 	}
@@ -161,7 +387,7 @@ func startWorker(l *zap.Logger, botToken string, index int) (*gotgproto.Client,
 		&gotgproto.ClientOpts{
 			Session:          sessionType,
 			DisableCopyright: true,
-			Middlewares:      GetFloodMiddleware(log.Desugar()),
+			Middlewares:      GetFloodMiddleware(log.Desugar(), floodWait),
 		},
 	)
 	if err != nil {
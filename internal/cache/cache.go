@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"EverythingSuckz/fsb/internal/metrics"
 	"EverythingSuckz/fsb/internal/types"
 	"bytes"
 	"encoding/gob"
@@ -36,6 +37,7 @@ func (c *Cache) Get(key string, value *types.File) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	data, err := cache.cache.Get([]byte(key))
+	metrics.CacheRequests.WithLabelValues("file", metrics.CacheResult(err == nil)).Inc()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,232 @@
+package cache
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/metrics"
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var chunkCache *ChunkCache
+
+// ChunkCache is a size capped, least recently used store of file chunks
+// on disk. Chunks are written to a temporary file and renamed into place,
+// so a crash never leaves a partial chunk behind.
+type ChunkCache struct {
+	dir     string
+	maxSize int64
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+	mu      sync.Mutex
+	log     *zap.Logger
+}
+
+type chunkEntry struct {
+	key  string
+	size int64
+}
+
+func InitChunkCache(log *zap.Logger) {
+	log = log.Named("chunkCache")
+	if config.ValueOf.ChunkCacheSize <= 0 {
+		log.Sugar().Info("Disabled")
+		return
+	}
+	dir := filepath.Clean(config.ValueOf.ChunkCacheDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Error("Failed to create chunk cache directory", zap.Error(err))
+		return
+	}
+	c := &ChunkCache{
+		dir:     dir,
+		maxSize: config.ValueOf.ChunkCacheSize * 1024 * 1024,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		log:     log,
+	}
+	if err := c.load(); err != nil {
+		log.Error("Failed to load chunk cache", zap.Error(err))
+		return
+	}
+	log.Sugar().Infof("Initialized with %d chunks (%d/%d MiB)", c.lru.Len(), c.size/1024/1024, config.ValueOf.ChunkCacheSize)
+	chunkCache = c
+}
+
+// GetChunkCache returns nil when the chunk cache is disabled.
+func GetChunkCache() *ChunkCache {
+	return chunkCache
+}
+
+// load indexes the chunks left by a previous run, oldest access first,
+// and removes temporary files of interrupted writes.
+func (c *ChunkCache) load() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	type stored struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var chunks []stored
+	for _, e := range dirEntries {
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			os.Remove(filepath.Join(c.dir, e.Name()))
+			continue
+		}
+		if !strings.HasSuffix(e.Name(), ".chunk") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		chunks = append(chunks, stored{strings.TrimSuffix(e.Name(), ".chunk"), info.Size(), info.ModTime()})
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].modTime.Before(chunks[j].modTime)
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, chunk := range chunks {
+		c.entries[chunk.key] = c.lru.PushFront(&chunkEntry{chunk.key, chunk.size})
+		c.size += chunk.size
+	}
+	c.evict()
+	return nil
+}
+
+func chunkKey(fileID int64, offset int64) string {
+	return fmt.Sprintf("%d-%d", fileID, offset)
+}
+
+func (c *ChunkCache) path(key string) string {
+	return filepath.Join(c.dir, key+".chunk")
+}
+
+// Get returns the chunk of the file starting at offset, if it is cached.
+func (c *ChunkCache) Get(fileID int64, offset int64) ([]byte, bool) {
+	key := chunkKey(fileID, offset)
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		metrics.CacheRequests.WithLabelValues("chunk", metrics.CacheResult(false)).Inc()
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		c.log.Warn("Failed to read cached chunk", zap.String("key", key), zap.Error(err))
+		c.mu.Lock()
+		c.remove(elem)
+		c.mu.Unlock()
+		metrics.CacheRequests.WithLabelValues("chunk", metrics.CacheResult(false)).Inc()
+		return nil, false
+	}
+	metrics.CacheRequests.WithLabelValues("chunk", metrics.CacheResult(true)).Inc()
+	// keep the access order across restarts
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	return data, true
+}
+
+// Put stores the chunk of the file starting at offset and evicts the least
+// recently used chunks until the cache fits its size cap again.
+func (c *ChunkCache) Put(fileID int64, offset int64, data []byte) error {
+	size := int64(len(data))
+	if size == 0 || size > c.maxSize {
+		return nil
+	}
+	key := chunkKey(fileID, offset)
+	c.mu.Lock()
+	_, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return nil
+	}
+	tmp, err := os.CreateTemp(c.dir, key+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		// another stream stored the same chunk meanwhile
+		return nil
+	}
+	c.entries[key] = c.lru.PushFront(&chunkEntry{key, size})
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// EvictFile removes every cached chunk of the file.
+func (c *ChunkCache) EvictFile(fileID int64) {
+	prefix := fmt.Sprintf("%d-", fileID)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, elem := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(elem)
+		}
+	}
+}
+
+// evict must be called with mu held.
+func (c *ChunkCache) evict() {
+	for c.size > c.maxSize {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			return
+		}
+		c.remove(oldest)
+	}
+}
+
+// remove must be called with mu held.
+func (c *ChunkCache) remove(elem *list.Element) {
+	entry := elem.Value.(*chunkEntry)
+	if c.entries[entry.key] != elem {
+		return
+	}
+	c.lru.Remove(elem)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+	if err := os.Remove(c.path(entry.key)); err != nil && !os.IsNotExist(err) {
+		c.log.Warn("Failed to remove cached chunk", zap.String("key", entry.key), zap.Error(err))
+	}
+}
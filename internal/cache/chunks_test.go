@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestChunkCache(t *testing.T, dir string, maxSize int64) *ChunkCache {
+	t.Helper()
+	c := &ChunkCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		log:     zap.NewNop(),
+	}
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func chunkFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names
+}
+
+func TestChunkCachePutGet(t *testing.T) {
+	c := newTestChunkCache(t, t.TempDir(), 100)
+	data := []byte("chunk data")
+	if err := c.Put(1, 0, data); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := c.Get(1, 0)
+	if !ok || !bytes.Equal(got, data) {
+		t.Fatalf("Get() = %q, %v, want %q", got, ok, data)
+	}
+	if _, ok := c.Get(1, 10); ok {
+		t.Errorf("Get() found a chunk at another offset")
+	}
+	if _, ok := c.Get(2, 0); ok {
+		t.Errorf("Get() found a chunk of another file")
+	}
+	// chunks larger than the cache are never stored
+	if err := c.Put(3, 0, make([]byte, 101)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(3, 0); ok {
+		t.Errorf("Get() found a chunk larger than the cache")
+	}
+	if c.size != int64(len(data)) {
+		t.Errorf("size = %d, want %d", c.size, len(data))
+	}
+}
+
+func TestChunkCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestChunkCache(t, dir, 30)
+	chunk := make([]byte, 10)
+	for offset := int64(0); offset < 30; offset += 10 {
+		if err := c.Put(1, offset, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// reading the oldest chunk makes the second one the least recently used
+	if _, ok := c.Get(1, 0); !ok {
+		t.Fatal("Get() missed a cached chunk")
+	}
+	if err := c.Put(1, 30, chunk); err != nil {
+		t.Fatal(err)
+	}
+	for offset, want := range map[int64]bool{0: true, 10: false, 20: true, 30: true} {
+		if _, ok := c.Get(1, offset); ok != want {
+			t.Errorf("Get(1, %d) found = %v, want %v", offset, ok, want)
+		}
+	}
+	if c.size != 30 {
+		t.Errorf("size = %d, want 30", c.size)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "1-10.chunk")); !os.IsNotExist(err) {
+		t.Errorf("evicted chunk is still on disk: %v", err)
+	}
+}
+
+func TestChunkCacheReload(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestChunkCache(t, dir, 100)
+	for offset := int64(0); offset < 30; offset += 10 {
+		if err := c.Put(1, offset, make([]byte, 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// make the access order explicit, the file system may not tell the
+	// writes above apart
+	base := time.Now().Add(-time.Hour)
+	for i, key := range []string{"1-10", "1-0", "1-20"} {
+		modTime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(c.path(key), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// an interrupted write and an unrelated file
+	os.WriteFile(filepath.Join(dir, "1-30-123.tmp"), []byte("partial"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep"), 0o644)
+
+	reloaded := newTestChunkCache(t, dir, 20)
+	if reloaded.lru.Len() != 2 || reloaded.size != 20 {
+		t.Fatalf("reloaded %d chunks of %d bytes, want 2 of 20", reloaded.lru.Len(), reloaded.size)
+	}
+	// the least recently used chunk doesn't fit the smaller cap anymore
+	for offset, want := range map[int64]bool{0: true, 10: false, 20: true} {
+		if _, ok := reloaded.Get(1, offset); ok != want {
+			t.Errorf("Get(1, %d) found = %v, want %v", offset, ok, want)
+		}
+	}
+	files := chunkFiles(t, dir)
+	want := []string{"1-0.chunk", "1-20.chunk", "notes.txt"}
+	if !slices.Equal(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
+
+func TestChunkCacheEvictFile(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestChunkCache(t, dir, 100)
+	// 12 shares its leading digit with 1 and must be kept
+	for _, fileID := range []int64{1, 12} {
+		for offset := int64(0); offset < 20; offset += 10 {
+			if err := c.Put(fileID, offset, make([]byte, 10)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	c.EvictFile(1)
+	for _, offset := range []int64{0, 10} {
+		if _, ok := c.Get(1, offset); ok {
+			t.Errorf("Get(1, %d) found an evicted chunk", offset)
+		}
+		if _, ok := c.Get(12, offset); !ok {
+			t.Errorf("Get(12, %d) missed a chunk of another file", offset)
+		}
+	}
+	if c.size != 20 {
+		t.Errorf("size = %d, want 20", c.size)
+	}
+	if files := chunkFiles(t, dir); !slices.Equal(files, []string{"12-0.chunk", "12-10.chunk"}) {
+		t.Errorf("files = %v", files)
+	}
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/metrics"
+	"EverythingSuckz/fsb/internal/utils"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/celestix/gotgproto/ext"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// albumWindow is how long to wait for the next message of an album before
+// answering it. Telegram delivers the messages of an album almost at once.
+const albumWindow = time.Second
+
+type albumKey struct {
+	chatID    int64
+	groupedID int64
+}
+
+// album gathers the messages of a media group sent to the bot.
+type album struct {
+	ctx        *ext.Context
+	update     *ext.Update
+	chatID     int64
+	messageIDs []int
+	ttl        time.Duration
+	// ttlSet is true once a caption asked for its own ttl
+	ttlSet bool
+	timer  *time.Timer
+}
+
+type albumCollector struct {
+	mu      sync.Mutex
+	pending map[albumKey]*album
+}
+
+var albums = &albumCollector{pending: make(map[albumKey]*album)}
+
+// add collects the message of the update into its album, which is answered
+// once no more messages arrived for albumWindow.
+func (c *albumCollector) add(ctx *ext.Context, u *ext.Update, ttl time.Duration) {
+	message := u.EffectiveMessage
+	key := albumKey{chatID: u.EffectiveChat().GetID(), groupedID: message.GroupedID}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, ok := c.pending[key]
+	if !ok {
+		a = &album{ctx: ctx, update: u, chatID: key.chatID, ttl: ttl}
+		a.timer = time.AfterFunc(albumWindow, func() {
+			c.mu.Lock()
+			delete(c.pending, key)
+			c.mu.Unlock()
+			a.send()
+		})
+		c.pending[key] = a
+	} else {
+		a.timer.Reset(albumWindow)
+	}
+	a.messageIDs = append(a.messageIDs, message.ID)
+	// usually only one message of an album has a caption
+	if !a.ttlSet && strings.Contains(strings.ToLower(message.Message.Message), "ttl=") {
+		a.ttl = ttl
+		a.ttlSet = true
+	}
+}
+
+// send forwards the album to the log channel in one request and replies
+// with the link of every file and a playlist of all of them.
+func (a *album) send() {
+	ctx, u := a.ctx, a.update
+	slices.Sort(a.messageIDs)
+	forwarded, err := utils.ForwardMessages(ctx, a.chatID, config.ValueOf.LogChannelID, a.messageIDs...)
+	if err != nil {
+		utils.Logger.Sugar().Error(err)
+		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
+		return
+	}
+	expiry := utils.LinkExpiry(a.ttl)
+	var sb strings.Builder
+	messageIDs := make([]int, 0, len(forwarded))
+	for _, message := range forwarded {
+		file, err := utils.FileFromMedia(message.Media)
+		if err != nil {
+			utils.Logger.Error("Skipping album file", zap.Int("messageID", message.ID), zap.Error(err))
+			continue
+		}
+		link := utils.GetStreamLink(message.ID, file, expiry)
+		metrics.LinksGenerated.Inc()
+		countLink()
+		saveLink(a.chatID, message.ID, file, link, expiry)
+		messageIDs = append(messageIDs, message.ID)
+		fmt.Fprintf(&sb, "📄 %d. %s\n📥 %s\n\n", len(messageIDs), file.FileName, link)
+	}
+	if len(messageIDs) == 0 {
+		ctx.Reply(u, "Sorry, none of the files of this album are supported.", nil)
+		return
+	}
+	playlist := utils.GetPlaylistLink(messageIDs, expiry)
+	fmt.Fprintf(&sb, "🎵 All Files:\n%s\n\n⏳ %s", playlist, linkValidity(a.ttl))
+
+	opts := &ext.ReplyOpts{
+		NoWebpage:        false,
+		ReplyToMessageId: a.messageIDs[0],
+	}
+	markup := &tg.ReplyInlineMarkup{}
+	if !strings.Contains(playlist, "http://localhost") {
+		markup.Rows = append(markup.Rows, tg.KeyboardButtonRow{
+			Buttons: []tg.KeyboardButtonClass{
+				&tg.KeyboardButtonURL{
+					Text: "Playlist",
+					URL:  playlist,
+				},
+			},
+		})
+	}
+	markup.Rows = append(markup.Rows, revokeAlbumRows(messageIDs)...)
+	opts.Markup = markup
+	if _, err := ctx.Reply(u, sb.String(), opts); err != nil {
+		utils.Logger.Sugar().Error(err)
+		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
+	}
+}
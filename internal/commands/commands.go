@@ -1,6 +1,10 @@
 package commands
 
 import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/utils"
+	"errors"
 	"reflect"
 
 	"github.com/celestix/gotgproto/dispatcher"
@@ -20,3 +24,25 @@ func Load(log *zap.Logger, dispatcher dispatcher.Dispatcher) {
 		Type.Method(i).Func.Call([]reflect.Value{Value, reflect.ValueOf(dispatcher)})
 	}
 }
+
+func isAdmin(userID int64) bool {
+	return utils.Contains(config.ValueOf.Admins, userID)
+}
+
+// isAllowed reports whether the user may use the bot. Admins always can,
+// banned users never can, and once users were allowed, only they can.
+func isAllowed(userID int64) bool {
+	if isAdmin(userID) {
+		return true
+	}
+	user, err := database.GetUser(userID)
+	if err == nil && user != nil {
+		return user.State == database.UserAllowed
+	}
+	restricted, err2 := database.HasAllowedUsers()
+	if err != nil || err2 != nil {
+		utils.Logger.Error("Failed to check user access, using ALLOWED_USERS", zap.Error(errors.Join(err, err2)))
+		return len(config.ValueOf.AllowedUsers) == 0 || utils.Contains(config.ValueOf.AllowedUsers, userID)
+	}
+	return !restricted
+}
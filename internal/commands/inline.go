@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	fsbtypes "EverythingSuckz/fsb/internal/types"
+	"EverythingSuckz/fsb/internal/utils"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/celestix/gotgproto/dispatcher"
+	"github.com/celestix/gotgproto/ext"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// inlineResults is the most results Telegram accepts per inline answer.
+const inlineResults = 50
+
+// saveLink remembers the link for the inline mode of the user.
+func saveLink(userID int64, messageID int, file *fsbtypes.File, link string, expiry int64) {
+	err := database.SaveLink(&database.Link{
+		UserID:    userID,
+		MessageID: messageID,
+		FileName:  file.FileName,
+		FileSize:  file.FileSize,
+		MimeType:  file.MimeType,
+		URL:       link,
+		Expiry:    expiry,
+	})
+	if err != nil {
+		utils.Logger.Error("Failed to save link", zap.Int64("userID", userID), zap.Error(err))
+	}
+}
+
+// inlineQuery answers "@bot <query>" with the links the user generated
+// for files whose name contains the query.
+func inlineQuery(ctx *ext.Context, u *ext.Update) error {
+	query := u.InlineQuery
+	results := []tg.InputBotInlineResultClass{}
+	var nextOffset string
+	if isAllowed(query.UserID) {
+		offset, _ := strconv.Atoi(query.Offset)
+		links, err := database.SearchLinks(query.UserID, strings.TrimSpace(query.Query), offset, inlineResults)
+		if err != nil {
+			utils.Logger.Error("Failed to search links", zap.Int64("userID", query.UserID), zap.Error(err))
+		}
+		for _, link := range links {
+			results = append(results, inlineResult(link))
+		}
+		if len(links) == inlineResults {
+			nextOffset = strconv.Itoa(offset + inlineResults)
+		}
+	}
+	_, err := ctx.SetInlineBotResult(&tg.MessagesSetInlineBotResultsRequest{
+		QueryID:    query.QueryID,
+		Results:    results,
+		CacheTime:  10,
+		Private:    true,
+		NextOffset: nextOffset,
+	})
+	if err != nil {
+		utils.Logger.Error("Failed to answer inline query", zap.Error(err))
+	}
+	return dispatcher.EndGroups
+}
+
+func inlineResult(link database.Link) tg.InputBotInlineResultClass {
+	validity := "Link never expires"
+	if link.Expiry != 0 {
+		validity = fmt.Sprintf("Link expires in %s", utils.FormatTTL(max(time.Until(time.Unix(link.Expiry, 0)).Round(time.Minute), time.Minute)))
+	}
+	message := &tg.InputBotInlineMessageText{
+		Message: fmt.Sprintf("📄 File Name: %s\n\n📥 Download Link:\n%s\n\n⏳ %s", link.FileName, link.URL, validity),
+	}
+	if !strings.Contains(link.URL, "http://localhost") {
+		message.SetReplyMarkup(linkMarkup(link.URL, link.MimeType))
+	}
+	return &tg.InputBotInlineResult{
+		ID:          strconv.FormatUint(uint64(link.ID), 10),
+		Type:        "article",
+		Title:       link.FileName,
+		Description: fmt.Sprintf("%s · %s", utils.SizeFormat(link.FileSize), validity),
+		SendMessage: message,
+	}
+}
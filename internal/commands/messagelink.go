@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/utils"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/celestix/gotgproto/dispatcher"
+	"github.com/celestix/gotgproto/ext"
+)
+
+// messageLinkPattern matches t.me/<channel>/<id> and t.me/c/<id>/<msg>
+// links, the message ID being the last number before an optional query.
+// The host must not be preceded by anything that makes it part of another
+// domain, like chat.me or notelegram.me.
+var messageLinkPattern = regexp.MustCompile(`(?i)(?:^|[^\w.-])(?:https?://)?(?:t|telegram)\.me/(?:c/(\d+)|([a-z]\w{3,31}))/(?:\d+/)?(\d+)`)
+
+// parseMessageLink finds a message link in the text and returns the
+// username or ID of its channel and the message ID.
+func parseMessageLink(text string) (string, int, bool) {
+	match := messageLinkPattern.FindStringSubmatch(text)
+	if match == nil {
+		return "", 0, false
+	}
+	messageID, err := strconv.Atoi(match[3])
+	if err != nil {
+		return "", 0, false
+	}
+	if match[1] != "" {
+		return match[1], messageID, true
+	}
+	return match[2], messageID, true
+}
+
+// linkFromMessageLink has the userbot copy the file of a channel message
+// into the log channel and replies with its stream link.
+func linkFromMessageLink(ctx *ext.Context, u *ext.Update, channel string, messageID int) error {
+	ttl, err := linkTTL(u.EffectiveMessage.Message.Message)
+	if err != nil {
+		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
+		return dispatcher.EndGroups
+	}
+	copied, err := bot.UserBot.CopyToLogChannel(ctx, channel, messageID)
+	if err != nil {
+		if !errors.Is(err, bot.ErrChannelNotAllowed) {
+			utils.Logger.Sugar().Error(err)
+		}
+		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
+		return dispatcher.EndGroups
+	}
+	file, err := utils.FileFromMedia(copied.Media)
+	if err != nil {
+		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
+		return dispatcher.EndGroups
+	}
+	return replyLink(ctx, u, copied.ID, file, ttl)
+}
@@ -0,0 +1,43 @@
+package commands
+
+import "testing"
+
+func TestParseMessageLink(t *testing.T) {
+	tests := []struct {
+		text      string
+		channel   string
+		messageID int
+		ok        bool
+	}{
+		{"https://t.me/somechannel/123", "somechannel", 123, true},
+		{"http://telegram.me/somechannel/123", "somechannel", 123, true},
+		{"t.me/somechannel/123", "somechannel", 123, true},
+		{"HTTPS://T.ME/SomeChannel/123", "SomeChannel", 123, true},
+		{"https://t.me/c/1234567890/45", "1234567890", 45, true},
+		{"https://t.me/c/1234567890/7/45", "1234567890", 45, true},
+		{"https://t.me/somechannel/7/45", "somechannel", 45, true},
+		{"https://t.me/somechannel/123?single", "somechannel", 123, true},
+		{"look at https://t.me/somechannel/123 ttl=1h", "somechannel", 123, true},
+		{"https://t.me/somechannel", "", 0, false},
+		{"https://t.me/abc/123", "", 0, false},
+		{"https://t.me/1channel/123", "", 0, false},
+		{"https://t.me/c/abc/123", "", 0, false},
+		{"https://example.com/somechannel/123", "", 0, false},
+		{"https://chat.me/news/12", "", 0, false},
+		{"notelegram.me/abcd/5", "", 0, false},
+		{"https://not.t.me/abcd/5", "", 0, false},
+		{"https://my-t.me/abcd/5", "", 0, false},
+		{"(t.me/somechannel/123)", "somechannel", 123, true},
+		{"link:\nhttps://t.me/somechannel/123", "somechannel", 123, true},
+		{"https://t.me/somechannel/99999999999999999999", "", 0, false},
+		{"no link here", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			channel, messageID, ok := parseMessageLink(tt.text)
+			if channel != tt.channel || messageID != tt.messageID || ok != tt.ok {
+				t.Errorf("parseMessageLink() = %q, %d, %v, want %q, %d, %v", channel, messageID, ok, tt.channel, tt.messageID, tt.ok)
+			}
+		})
+	}
+}
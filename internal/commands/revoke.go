@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/utils"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/celestix/gotgproto/dispatcher"
+	"github.com/celestix/gotgproto/dispatcher/handlers"
+	"github.com/celestix/gotgproto/dispatcher/handlers/filters"
+	"github.com/celestix/gotgproto/ext"
+	"github.com/celestix/gotgproto/storage"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+const (
+	revokePrefix = "revoke:"
+	// album replies hold the links of other files too, so they are left as
+	// they are when one file is revoked
+	revokeAlbumPrefix = "revoke-album:"
+)
+
+var streamLinkPattern = regexp.MustCompile(`/stream/(\d+)\?`)
+
+func (m *command) LoadRevoke(dispatcher dispatcher.Dispatcher) {
+	log := m.log.Named("revoke")
+	defer log.Sugar().Info("Loaded")
+	dispatcher.AddHandler(handlers.NewCommand("revoke", revoke))
+	dispatcher.AddHandler(handlers.NewCallbackQuery(filters.CallbackQuery.Prefix(revokePrefix), revokeButton))
+	dispatcher.AddHandler(handlers.NewCallbackQuery(filters.CallbackQuery.Prefix(revokeAlbumPrefix), revokeButton))
+}
+
+// revokeRow returns the button revoking the links of the log channel
+// message.
+func revokeRow(messageID int) tg.KeyboardButtonRow {
+	return tg.KeyboardButtonRow{
+		Buttons: []tg.KeyboardButtonClass{
+			&tg.KeyboardButtonCallback{
+				Text: "Revoke",
+				Data: []byte(revokePrefix + strconv.Itoa(messageID)),
+			},
+		},
+	}
+}
+
+// revokeAlbumRows returns a numbered button per file of an album, in rows
+// of up to five.
+func revokeAlbumRows(messageIDs []int) []tg.KeyboardButtonRow {
+	var rows []tg.KeyboardButtonRow
+	for i, messageID := range messageIDs {
+		if i%5 == 0 {
+			rows = append(rows, tg.KeyboardButtonRow{})
+		}
+		row := &rows[len(rows)-1]
+		row.Buttons = append(row.Buttons, &tg.KeyboardButtonCallback{
+			Text: fmt.Sprintf("Revoke %d", i+1),
+			Data: []byte(revokeAlbumPrefix + strconv.Itoa(messageID)),
+		})
+	}
+	return rows
+}
+
+func revoke(ctx *ext.Context, u *ext.Update) error {
+	chatId := u.EffectiveChat().GetID()
+	peerChatId := ctx.PeerStorage.GetPeerById(chatId)
+	if peerChatId.Type != int(storage.TypeUser) {
+		return dispatcher.EndGroups
+	}
+	match := streamLinkPattern.FindStringSubmatch(u.EffectiveMessage.Text)
+	if match == nil {
+		ctx.Reply(u, "Usage: /revoke <link>", nil)
+		return dispatcher.EndGroups
+	}
+	messageID, err := strconv.Atoi(match[1])
+	if err == nil {
+		err = revokeLink(ctx, chatId, messageID)
+	}
+	if err != nil {
+		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
+		return dispatcher.EndGroups
+	}
+	ctx.Reply(u, "The link was revoked, it doesn't work anymore.", nil)
+	return dispatcher.EndGroups
+}
+
+func revokeButton(ctx *ext.Context, u *ext.Update) error {
+	query := u.CallbackQuery
+	data, album := strings.CutPrefix(string(query.Data), revokeAlbumPrefix)
+	if !album {
+		data = strings.TrimPrefix(data, revokePrefix)
+	}
+	messageID, err := strconv.Atoi(data)
+	if err == nil {
+		err = revokeLink(ctx, query.UserID, messageID)
+	}
+	answer := &tg.MessagesSetBotCallbackAnswerRequest{QueryID: query.QueryID}
+	if err != nil {
+		answer.Alert = true
+		answer.Message = fmt.Sprintf("Error - %s", err.Error())
+		ctx.AnswerCallback(answer)
+		return dispatcher.EndGroups
+	}
+	answer.Message = "Link revoked"
+	ctx.AnswerCallback(answer)
+	if album {
+		return dispatcher.EndGroups
+	}
+	_, err = ctx.EditMessage(u.EffectiveChat().GetID(), &tg.MessagesEditMessageRequest{
+		ID:      query.MsgID,
+		Message: "🚫 This link was revoked.",
+	})
+	if err != nil {
+		utils.Logger.Debug("Failed to edit revoked link message", zap.Error(err))
+	}
+	return dispatcher.EndGroups
+}
+
+// revokeLink blocklists the log channel message so that its links answer
+// 410 Gone, and deletes it. Only the user the link was generated for and
+// the admins may revoke it.
+func revokeLink(ctx *ext.Context, userID int64, messageID int) error {
+	revoked, err := database.IsRevoked(messageID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return errors.New("this link was already revoked")
+	}
+	owner, err := database.GetLinkOwner(messageID)
+	if err != nil {
+		return err
+	}
+	if owner != userID && !isAdmin(userID) {
+		return errors.New("only the uploader of a file or an admin can revoke its link")
+	}
+	if err := database.RevokeMessage(messageID, userID); err != nil {
+		return err
+	}
+	utils.EvictFile(ctx, messageID)
+	utils.Logger.Info("Link revoked", zap.Int("messageID", messageID), zap.Int64("userID", userID))
+	channel, err := utils.GetLogChannelPeer(ctx, ctx.Raw, ctx.PeerStorage)
+	if err == nil {
+		_, err = ctx.Raw.ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{
+			Channel: channel,
+			ID:      []int{messageID},
+		})
+	}
+	if err != nil {
+		// the blocklist is enough to kill the link
+		utils.Logger.Warn("Failed to delete revoked message from the log channel", zap.Int("messageID", messageID), zap.Error(err))
+	}
+	return nil
+}
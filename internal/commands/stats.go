@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/metrics"
+	"EverythingSuckz/fsb/internal/utils"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/celestix/gotgproto/dispatcher"
+	"github.com/celestix/gotgproto/dispatcher/handlers"
+	"github.com/celestix/gotgproto/ext"
+)
+
+// linksToday counts the links generated since midnight, server time.
+var linksToday struct {
+	mu    sync.Mutex
+	day   string
+	count int
+}
+
+func countLink() {
+	linksToday.mu.Lock()
+	defer linksToday.mu.Unlock()
+	if day := time.Now().Format(time.DateOnly); day != linksToday.day {
+		linksToday.day = day
+		linksToday.count = 0
+	}
+	linksToday.count++
+}
+
+func getLinksToday() int {
+	linksToday.mu.Lock()
+	defer linksToday.mu.Unlock()
+	if linksToday.day != time.Now().Format(time.DateOnly) {
+		return 0
+	}
+	return linksToday.count
+}
+
+func (m *command) LoadStats(dispatcher dispatcher.Dispatcher) {
+	log := m.log.Named("stats")
+	defer log.Sugar().Info("Loaded")
+	dispatcher.AddHandler(handlers.NewCommand("stats", stats))
+}
+
+func stats(ctx *ext.Context, u *ext.Update) error {
+	return adminCommand(ctx, u, func(args []string) string {
+		return statsText()
+	})
+}
+
+func statsText() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Uptime: %s\n", utils.TimeFormat(uint64(time.Since(utils.StartTime).Seconds())))
+	fmt.Fprintf(&sb, "Active streams: %d\n", int64(metrics.Value(metrics.ActiveStreams)))
+	fmt.Fprintf(&sb, "Served: %s\n", utils.SizeFormat(int64(metrics.Value(metrics.ResponseBytes))))
+	fmt.Fprintf(&sb, "Links today: %d\n", getLinksToday())
+	fmt.Fprintf(&sb, "File cache hit ratio: %s\n", hitRatio("file"))
+	if config.ValueOf.ChunkCacheSize > 0 {
+		fmt.Fprintf(&sb, "Chunk cache hit ratio: %s\n", hitRatio("chunk"))
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Fprintf(&sb, "Memory: %s in use, %s reserved, %d goroutines\n",
+		utils.SizeFormat(int64(mem.HeapAlloc)), utils.SizeFormat(int64(mem.Sys)), runtime.NumGoroutine())
+	sb.WriteString("\nWorkers:\n")
+	for _, w := range bot.Workers.List() {
+		fmt.Fprintf(&sb, "%d. @%s - %s, %d active streams, %d errors\n", w.ID, w.Self.Username, workerStatus(w), w.ActiveStreams(), w.Errors())
+	}
+	return sb.String()
+}
+
+func hitRatio(cache string) string {
+	hits := metrics.Value(metrics.CacheRequests.WithLabelValues(cache, metrics.CacheResult(true)))
+	misses := metrics.Value(metrics.CacheRequests.WithLabelValues(cache, metrics.CacheResult(false)))
+	if hits+misses == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f%% (%d/%d)", hits/(hits+misses)*100, int64(hits), int64(hits+misses))
+}
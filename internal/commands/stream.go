@@ -2,13 +2,18 @@ package commands
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
+	"time"
 
 	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/metrics"
+	fsbtypes "EverythingSuckz/fsb/internal/types"
 	"EverythingSuckz/fsb/internal/utils"
 
 	"github.com/celestix/gotgproto/dispatcher"
 	"github.com/celestix/gotgproto/dispatcher/handlers"
+	"github.com/celestix/gotgproto/dispatcher/handlers/filters"
 	"github.com/celestix/gotgproto/ext"
 	"github.com/celestix/gotgproto/storage"
 	"github.com/celestix/gotgproto/types"
@@ -19,9 +24,13 @@ import (
 func (m *command) LoadStream(dispatcher dispatcher.Dispatcher) {
 	log := m.log.Named("start")
 	defer log.Sugar().Info("Loaded")
-	dispatcher.AddHandler(
+	// every command lives in the default group, so that they are
+	// handled before any text reaches sendLink
+	dispatcher.AddHandlerToGroup(
 		handlers.NewMessage(nil, sendLink),
+		1,
 	)
+	dispatcher.AddHandler(handlers.NewInlineQuery(filters.InlineQuery.All, inlineQuery))
 }
 
 func supportedMediaFilter(m *types.Message) (bool, error) {
@@ -40,13 +49,42 @@ func supportedMediaFilter(m *types.Message) (bool, error) {
 	}
 }
 
+// linkTTL returns the TTL requested through a "ttl=<duration>" word in the
+// caption, or the configured default.
+func linkTTL(caption string) (time.Duration, error) {
+	ttl := config.ValueOf.LinkTTL
+	for _, word := range strings.Fields(caption) {
+		value, ok := strings.CutPrefix(strings.ToLower(word), "ttl=")
+		if !ok {
+			continue
+		}
+		requested, err := utils.ParseTTL(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ttl %q, use something like ttl=12h or ttl=7d", value)
+		}
+		ttl = requested
+	}
+	maxTTL := config.ValueOf.MaxLinkTTL
+	if maxTTL > 0 && (ttl == 0 || ttl > maxTTL) {
+		return 0, fmt.Errorf("links can be valid for at most %s", utils.FormatTTL(maxTTL))
+	}
+	return ttl, nil
+}
+
+func linkValidity(ttl time.Duration) string {
+	if ttl <= 0 {
+		return "Link never expires"
+	}
+	return fmt.Sprintf("Link validity is %s", utils.FormatTTL(ttl))
+}
+
 func sendLink(ctx *ext.Context, u *ext.Update) error {
 	chatId := u.EffectiveChat().GetID()
 	peerChatId := ctx.PeerStorage.GetPeerById(chatId)
 	if peerChatId.Type != int(storage.TypeUser) {
 		return dispatcher.EndGroups
 	}
-	if len(config.ValueOf.AllowedUsers) != 0 && !utils.Contains(config.ValueOf.AllowedUsers, chatId) {
+	if !isAllowed(chatId) {
 		ctx.Reply(u, "You are not allowed to use this bot.", nil)
 		return dispatcher.EndGroups
 	}
@@ -96,6 +134,12 @@ func sendLink(ctx *ext.Context, u *ext.Update) error {
 		}
 	}
 
+	if u.EffectiveMessage.Media == nil {
+		if channel, messageID, ok := parseMessageLink(u.EffectiveMessage.Message.Message); ok {
+			return linkFromMessageLink(ctx, u, channel, messageID)
+		}
+	}
+
 	supported, err := supportedMediaFilter(u.EffectiveMessage)
 	if err != nil {
 		return err
@@ -104,31 +148,61 @@ func sendLink(ctx *ext.Context, u *ext.Update) error {
 		ctx.Reply(u, "Sorry, this message type is unsupported.", nil)
 		return dispatcher.EndGroups
 	}
-	update, err := utils.ForwardMessages(ctx, chatId, config.ValueOf.LogChannelID, u.EffectiveMessage.ID)
+	ttl, err := linkTTL(u.EffectiveMessage.Message.Message)
+	if err != nil {
+		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
+		return dispatcher.EndGroups
+	}
+	if u.EffectiveMessage.GroupedID != 0 {
+		albums.add(ctx, u, ttl)
+		return dispatcher.EndGroups
+	}
+	forwarded, err := utils.ForwardMessages(ctx, chatId, config.ValueOf.LogChannelID, u.EffectiveMessage.ID)
 	if err != nil {
 		utils.Logger.Sugar().Error(err)
 		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
 		return dispatcher.EndGroups
 	}
-	messageID := update.Updates[0].(*tg.UpdateMessageID).ID
-	doc := update.Updates[1].(*tg.UpdateNewChannelMessage).Message.(*tg.Message).Media
-	file, err := utils.FileFromMedia(doc)
+	messageID := forwarded[0].ID
+	file, err := utils.FileFromMedia(forwarded[0].Media)
 	if err != nil {
 		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
 		return dispatcher.EndGroups
 	}
-	fullHash := utils.PackFile(
-		file.FileName,
-		file.FileSize,
-		file.MimeType,
-		file.ID,
-	)
-	hash := utils.GetShortHash(fullHash)
-	link := fmt.Sprintf("%s/stream/%d?hash=%s", config.ValueOf.Host, messageID, hash)
-	
+	return replyLink(ctx, u, messageID, file, ttl)
+}
+
+// replyLink answers the update with the stream link of the file stored in
+// the log channel message.
+func replyLink(ctx *ext.Context, u *ext.Update, messageID int, file *fsbtypes.File, ttl time.Duration) error {
+	expiry := utils.LinkExpiry(ttl)
+	link := utils.GetStreamLink(messageID, file, expiry)
+	metrics.LinksGenerated.Inc()
+	countLink()
+	saveLink(u.EffectiveChat().GetID(), messageID, file, link, expiry)
+
 	// Create formatted message with clickable hyperlink
-	message := fmt.Sprintf("📄 File Name: %s\n\n📥 Download Link:\n%s\n\n⏳ Link validity is 24 hours", file.FileName, link)
-	
+	message := fmt.Sprintf("📄 File Name: %s\n\n📥 Download Link:\n%s\n\n⏳ %s", file.FileName, link, linkValidity(ttl))
+
+	markup := &tg.ReplyInlineMarkup{}
+	if !strings.Contains(link, "http://localhost") {
+		markup = linkMarkup(link, file.MimeType)
+	}
+	markup.Rows = append(markup.Rows, revokeRow(messageID))
+	_, err := ctx.Reply(u, message, &ext.ReplyOpts{
+		Markup:           markup,
+		NoWebpage:        false,
+		ReplyToMessageId: u.EffectiveMessage.ID,
+	})
+	if err != nil {
+		utils.Logger.Sugar().Error(err)
+		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
+	}
+	return dispatcher.EndGroups
+}
+
+// linkMarkup returns the buttons sent along with a stream link.
+func linkMarkup(link string, mimeType string) *tg.ReplyInlineMarkup {
 	row := tg.KeyboardButtonRow{
 		Buttons: []tg.KeyboardButtonClass{
 			&tg.KeyboardButtonURL{
@@ -138,31 +212,14 @@ func sendLink(ctx *ext.Context, u *ext.Update) error {
 		},
 	}
 	// Add Stream button only for video files
-	if strings.Contains(file.MimeType, "video") {
-		streamURL := fmt.Sprintf("https://stream.hariharantelegram.workers.dev/?video=%s", link)
+	if strings.Contains(mimeType, "video") {
+		streamURL := "https://stream.hariharantelegram.workers.dev/?video=" + url.QueryEscape(link)
 		row.Buttons = append(row.Buttons, &tg.KeyboardButtonURL{
 			Text: "Stream",
 			URL:  streamURL,
 		})
 	}
-	markup := &tg.ReplyInlineMarkup{
+	return &tg.ReplyInlineMarkup{
 		Rows: []tg.KeyboardButtonRow{row},
 	}
-	if strings.Contains(link, "http://localhost") {
-		_, err = ctx.Reply(u, message, &ext.ReplyOpts{
-			NoWebpage:        false,
-			ReplyToMessageId: u.EffectiveMessage.ID,
-		})
-	} else {
-		_, err = ctx.Reply(u, message, &ext.ReplyOpts{
-			Markup:           markup,
-			NoWebpage:        false,
-			ReplyToMessageId: u.EffectiveMessage.ID,
-		})
-	}
-	if err != nil {
-		utils.Logger.Sugar().Error(err)
-		ctx.Reply(u, fmt.Sprintf("Error - %s", err.Error()), nil)
-	}
-	return dispatcher.EndGroups
 }
@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/utils"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/celestix/gotgproto/dispatcher"
+	"github.com/celestix/gotgproto/dispatcher/handlers"
+	"github.com/celestix/gotgproto/ext"
+	"github.com/celestix/gotgproto/storage"
+)
+
+func (m *command) LoadUsers(dispatcher dispatcher.Dispatcher) {
+	log := m.log.Named("users")
+	defer log.Sugar().Info("Loaded")
+	dispatcher.AddHandler(handlers.NewCommand("ban", ban))
+	dispatcher.AddHandler(handlers.NewCommand("unban", unban))
+	dispatcher.AddHandler(handlers.NewCommand("allow", allow))
+	dispatcher.AddHandler(handlers.NewCommand("users", users))
+}
+
+// adminCommand runs fn for the admins in private chats and replies with its
+// result.
+func adminCommand(ctx *ext.Context, u *ext.Update, fn func(args []string) string) error {
+	chatId := u.EffectiveChat().GetID()
+	peerChatId := ctx.PeerStorage.GetPeerById(chatId)
+	if peerChatId.Type != int(storage.TypeUser) {
+		return dispatcher.EndGroups
+	}
+	if !isAdmin(chatId) {
+		ctx.Reply(u, "You are not allowed to use this command.", nil)
+		return dispatcher.EndGroups
+	}
+	ctx.Reply(u, fn(strings.Fields(u.EffectiveMessage.Text)[1:]), nil)
+	return dispatcher.EndGroups
+}
+
+// userArg returns the ID of the user given as an ID or a @username.
+func userArg(ctx *ext.Context, args []string) (int64, error) {
+	if len(args) == 0 {
+		return 0, errors.New("missing user ID or @username")
+	}
+	if id, err := strconv.ParseInt(args[0], 10, 64); err == nil {
+		return id, nil
+	}
+	chat, err := ctx.ResolveUsername(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("can't find %s", args[0])
+	}
+	if !chat.IsAUser() {
+		return 0, fmt.Errorf("%s is not a user", args[0])
+	}
+	return chat.GetID(), nil
+}
+
+func ban(ctx *ext.Context, u *ext.Update) error {
+	return adminCommand(ctx, u, func(args []string) string {
+		id, err := userArg(ctx, args)
+		if err != nil {
+			return fmt.Sprintf("Error - %s\n\nUsage: /ban <user ID|@username>", err.Error())
+		}
+		if isAdmin(id) {
+			return "Admins can't be banned."
+		}
+		if err := database.SaveUser(id, database.UserBanned); err != nil {
+			return fmt.Sprintf("Error - %s", err.Error())
+		}
+		return fmt.Sprintf("User %d is banned.", id)
+	})
+}
+
+func unban(ctx *ext.Context, u *ext.Update) error {
+	return adminCommand(ctx, u, func(args []string) string {
+		id, err := userArg(ctx, args)
+		if err != nil {
+			return fmt.Sprintf("Error - %s\n\nUsage: /unban <user ID|@username>", err.Error())
+		}
+		user, err := database.GetUser(id)
+		if err != nil {
+			return fmt.Sprintf("Error - %s", err.Error())
+		}
+		if user == nil || user.State != database.UserBanned {
+			return fmt.Sprintf("User %d is not banned.", id)
+		}
+		// users from ALLOWED_USERS go back to being allowed
+		if utils.Contains(config.ValueOf.AllowedUsers, id) {
+			err = database.SaveUser(id, database.UserAllowed)
+		} else {
+			err = database.DeleteUser(id)
+		}
+		if err != nil {
+			return fmt.Sprintf("Error - %s", err.Error())
+		}
+		return fmt.Sprintf("User %d is unbanned.", id)
+	})
+}
+
+func allow(ctx *ext.Context, u *ext.Update) error {
+	return adminCommand(ctx, u, func(args []string) string {
+		id, err := userArg(ctx, args)
+		if err != nil {
+			return fmt.Sprintf("Error - %s\n\nUsage: /allow <user ID|@username>", err.Error())
+		}
+		restricted, err := database.HasAllowedUsers()
+		if err != nil {
+			return fmt.Sprintf("Error - %s", err.Error())
+		}
+		if err := database.SaveUser(id, database.UserAllowed); err != nil {
+			return fmt.Sprintf("Error - %s", err.Error())
+		}
+		if !restricted {
+			return fmt.Sprintf("User %d is allowed. From now on, only allowed users can use the bot.", id)
+		}
+		return fmt.Sprintf("User %d is allowed.", id)
+	})
+}
+
+func users(ctx *ext.Context, u *ext.Update) error {
+	return adminCommand(ctx, u, func(args []string) string {
+		users, err := database.GetUsers()
+		if err != nil {
+			return fmt.Sprintf("Error - %s", err.Error())
+		}
+		var allowed, banned []string
+		for _, user := range users {
+			switch user.State {
+			case database.UserAllowed:
+				allowed = append(allowed, strconv.FormatInt(user.ID, 10))
+			case database.UserBanned:
+				banned = append(banned, strconv.FormatInt(user.ID, 10))
+			}
+		}
+		var sb strings.Builder
+		if len(allowed) == 0 {
+			sb.WriteString("Allowed: everyone\n")
+		} else {
+			fmt.Fprintf(&sb, "Allowed (%d): %s\n", len(allowed), strings.Join(allowed, ", "))
+		}
+		if len(banned) == 0 {
+			sb.WriteString("Banned: nobody\n")
+		} else {
+			fmt.Fprintf(&sb, "Banned (%d): %s\n", len(banned), strings.Join(banned, ", "))
+		}
+		return sb.String()
+	})
+}
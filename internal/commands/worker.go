@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/database"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/celestix/gotgproto/dispatcher"
+	"github.com/celestix/gotgproto/dispatcher/handlers"
+	"github.com/celestix/gotgproto/ext"
+	"github.com/celestix/gotgproto/storage"
+)
+
+const workerUsage = `Usage:
+/worker list
+/worker add <bot token>
+/worker disable <@username|id>
+/worker enable <@username>
+/worker remove <@username|id>`
+
+func (m *command) LoadWorker(dispatcher dispatcher.Dispatcher) {
+	log := m.log.Named("worker")
+	defer log.Sugar().Info("Loaded")
+	dispatcher.AddHandler(handlers.NewCommand("worker", worker))
+}
+
+func worker(ctx *ext.Context, u *ext.Update) error {
+	chatId := u.EffectiveChat().GetID()
+	peerChatId := ctx.PeerStorage.GetPeerById(chatId)
+	if peerChatId.Type != int(storage.TypeUser) {
+		return dispatcher.EndGroups
+	}
+	if !isAdmin(chatId) {
+		ctx.Reply(u, "You are not allowed to use this command.", nil)
+		return dispatcher.EndGroups
+	}
+	args := strings.Fields(u.EffectiveMessage.Text)[1:]
+	if len(args) == 0 || (args[0] != "list" && len(args) < 2) {
+		ctx.Reply(u, workerUsage, nil)
+		return dispatcher.EndGroups
+	}
+	var reply string
+	switch strings.ToLower(args[0]) {
+	case "list":
+		reply = listWorkers()
+	case "add":
+		// don't leave the token lying around in the chat
+		ctx.DeleteMessages(chatId, []int{u.EffectiveMessage.ID})
+		w, err := bot.Workers.AddToken(args[1])
+		if err != nil {
+			reply = fmt.Sprintf("Error - %s", err.Error())
+		} else {
+			reply = fmt.Sprintf("Worker @%s started with ID %d", w.Self.Username, w.ID)
+		}
+	case "disable":
+		w, err := bot.Workers.Disable(args[1])
+		if err != nil {
+			reply = fmt.Sprintf("Error - %s", err.Error())
+		} else {
+			reply = fmt.Sprintf("Worker @%s disabled, it stops once its %d streams are done", w.Self.Username, w.ActiveStreams())
+		}
+	case "enable":
+		w, err := bot.Workers.Enable(args[1])
+		if err != nil {
+			reply = fmt.Sprintf("Error - %s", err.Error())
+		} else {
+			reply = fmt.Sprintf("Worker @%s enabled with ID %d", w.Self.Username, w.ID)
+		}
+	case "remove":
+		w, err := bot.Workers.Remove(args[1])
+		if err != nil {
+			reply = fmt.Sprintf("Error - %s", err.Error())
+		} else if w != nil {
+			reply = fmt.Sprintf("Worker @%s removed, it stops once its %d streams are done", w.Self.Username, w.ActiveStreams())
+		} else {
+			reply = fmt.Sprintf("Worker %s removed", args[1])
+		}
+	default:
+		reply = workerUsage
+	}
+	ctx.Reply(u, reply, nil)
+	return dispatcher.EndGroups
+}
+
+// workerStatus is the status of the worker, with the time left to wait if
+// it is flood waiting.
+func workerStatus(w *bot.Worker) string {
+	status := w.Status()
+	if wait := w.FloodWait(); wait > 0 {
+		status += " for " + wait.Round(time.Second).String()
+	}
+	return status
+}
+
+func listWorkers() string {
+	var sb strings.Builder
+	sb.WriteString("Workers:\n")
+	for _, w := range bot.Workers.List() {
+		fmt.Fprintf(&sb, "%d. @%s - %s, %d active streams\n", w.ID, w.Self.Username, workerStatus(w), w.ActiveStreams())
+	}
+	tokens, err := database.GetWorkerTokens()
+	if err == nil {
+		for _, token := range tokens {
+			if token.State == database.WorkerDisabled {
+				fmt.Fprintf(&sb, "-. @%s - disabled\n", token.Username)
+			}
+		}
+	}
+	return sb.String()
+}
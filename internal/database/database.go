@@ -0,0 +1,33 @@
+package database
+
+import (
+	"EverythingSuckz/fsb/config"
+
+	"github.com/glebarez/sqlite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var db *gorm.DB
+
+// Init opens the database holding the state changed at runtime and
+// migrates its tables.
+func Init(log *zap.Logger) error {
+	log = log.Named("database")
+	conn, err := gorm.Open(sqlite.Open(config.ValueOf.DatabasePath), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return err
+	}
+	if err := conn.AutoMigrate(&WorkerToken{}, &Setting{}, &User{}, &Link{}, &RevokedMessage{}); err != nil {
+		return err
+	}
+	db = conn
+	if err := seedUsers(config.ValueOf.AllowedUsers); err != nil {
+		return err
+	}
+	log.Sugar().Infof("Initialized %s", config.ValueOf.DatabasePath)
+	return nil
+}
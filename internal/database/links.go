@@ -0,0 +1,78 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Link is a stream link generated for a user, kept so that users can find
+// their files again.
+type Link struct {
+	ID        uint  `gorm:"primaryKey"`
+	UserID    int64 `gorm:"index"`
+	MessageID int   `gorm:"index"`
+	FileName  string
+	FileSize  int64
+	MimeType  string
+	URL       string
+	// Expiry is the unix time the link expires at, 0 if it never does.
+	Expiry    int64
+	CreatedAt time.Time
+}
+
+func SaveLink(link *Link) error {
+	return db.Create(link).Error
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchLinks returns the links of the user that are still valid and whose
+// file name contains query, newest first.
+func SearchLinks(userID int64, query string, offset, limit int) ([]Link, error) {
+	var links []Link
+	tx := db.Where("user_id = ? AND (expiry = 0 OR expiry > ?)", userID, time.Now().Unix())
+	if query != "" {
+		tx = tx.Where(`file_name LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(query)+"%")
+	}
+	err := tx.Order("id DESC").Offset(offset).Limit(limit).Find(&links).Error
+	return links, err
+}
+
+// GetLinkOwner returns the user the links of the log channel message were
+// generated for, 0 if there is no record of it.
+func GetLinkOwner(messageID int) (int64, error) {
+	var link Link
+	err := db.Where("message_id = ?", messageID).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return link.UserID, err
+}
+
+// RevokedMessage is a log channel message whose links were revoked.
+type RevokedMessage struct {
+	MessageID int `gorm:"primaryKey;autoIncrement:false"`
+	RevokedBy int64
+	CreatedAt time.Time
+}
+
+// RevokeMessage blocklists the log channel message and forgets its links.
+func RevokeMessage(messageID int, revokedBy int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&RevokedMessage{MessageID: messageID, RevokedBy: revokedBy}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("message_id = ?", messageID).Delete(&Link{}).Error
+	})
+}
+
+func IsRevoked(messageID int) (bool, error) {
+	var count int64
+	err := db.Model(&RevokedMessage{}).Where("message_id = ?", messageID).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// Setting is a value configured at runtime that has to survive restarts.
+type Setting struct {
+	Key   string `gorm:"primaryKey"`
+	Value string
+}
+
+const (
+	logChannelKey = "log_channel"
+	// replacedLogChannelKey is the LOG_CHANNEL the stored log channel was
+	// created in place of.
+	replacedLogChannelKey = "replaced_log_channel"
+)
+
+// GetSetting returns an empty string if the setting isn't stored.
+func GetSetting(key string) (string, error) {
+	var setting Setting
+	err := db.First(&setting, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return setting.Value, err
+}
+
+func SaveSetting(key string, value string) error {
+	return db.Save(&Setting{Key: key, Value: value}).Error
+}
+
+// GetLogChannel returns the log channel created at runtime and the
+// LOG_CHANNEL it replaced, zeros if there is none.
+func GetLogChannel() (channelID int64, replaced int64, err error) {
+	value, err := GetSetting(logChannelKey)
+	if err != nil || value == "" {
+		return 0, 0, err
+	}
+	if channelID, err = strconv.ParseInt(value, 10, 64); err != nil {
+		return 0, 0, err
+	}
+	value, err = GetSetting(replacedLogChannelKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	replaced, _ = strconv.ParseInt(value, 10, 64)
+	return channelID, replaced, nil
+}
+
+func SaveLogChannel(channelID int64, replaced int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&Setting{Key: logChannelKey, Value: strconv.FormatInt(channelID, 10)}).Error; err != nil {
+			return err
+		}
+		return tx.Save(&Setting{Key: replacedLogChannelKey, Value: strconv.FormatInt(replaced, 10)}).Error
+	})
+}
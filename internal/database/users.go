@@ -0,0 +1,71 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UserState string
+
+const (
+	UserAllowed UserState = "allowed"
+	UserBanned  UserState = "banned"
+)
+
+// User is a user an admin allowed or banned. Once a user is allowed, only
+// allowed users can use the bot.
+type User struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	State     UserState
+	UpdatedAt time.Time
+}
+
+// GetUser returns nil if the user was never allowed or banned.
+func GetUser(id int64) (*User, error) {
+	var user User
+	err := db.First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func GetUsers() ([]User, error) {
+	var users []User
+	err := db.Order("state, id").Find(&users).Error
+	return users, err
+}
+
+// HasAllowedUsers reports whether the bot is restricted to allowed users.
+func HasAllowedUsers() (bool, error) {
+	var count int64
+	err := db.Model(&User{}).Where("state = ?", UserAllowed).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+func SaveUser(id int64, state UserState) error {
+	return db.Save(&User{ID: id, State: state}).Error
+}
+
+func DeleteUser(id int64) error {
+	return db.Delete(&User{}, id).Error
+}
+
+// seedUsers allows the users of ALLOWED_USERS that the admins haven't
+// allowed or banned yet.
+func seedUsers(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	users := make([]User, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, User{ID: id, State: UserAllowed})
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&users).Error
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type WorkerState string
+
+const (
+	WorkerEnabled  WorkerState = "enabled"
+	WorkerDisabled WorkerState = "disabled"
+	// WorkerRemoved keeps tokens that also come from the environment from
+	// being started again after a restart.
+	WorkerRemoved WorkerState = "removed"
+)
+
+// WorkerToken is a worker bot token managed at runtime.
+type WorkerToken struct {
+	Token    string `gorm:"primaryKey"`
+	Username string `gorm:"index"`
+	State    WorkerState
+}
+
+// GetWorkerTokens returns every worker token known to the database.
+func GetWorkerTokens() ([]WorkerToken, error) {
+	var tokens []WorkerToken
+	err := db.Find(&tokens).Error
+	return tokens, err
+}
+
+// GetWorkerTokenByUsername returns nil if no token belongs to the bot.
+func GetWorkerTokenByUsername(username string) (*WorkerToken, error) {
+	var token WorkerToken
+	err := db.Where("username = ? COLLATE NOCASE", username).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func SaveWorkerToken(token string, username string, state WorkerState) error {
+	return db.Save(&WorkerToken{Token: token, Username: username, State: state}).Error
+}
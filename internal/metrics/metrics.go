@@ -0,0 +1,85 @@
+// Package metrics holds the Prometheus metrics of the server. It doesn't
+// depend on the other packages, so that any of them can record metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fsb_http_requests_total",
+		Help: "HTTP requests served, by route and status.",
+	}, []string{"route", "status"})
+	ResponseBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fsb_http_response_bytes_total",
+		Help: "Bytes of the HTTP responses, by route and status.",
+	}, []string{"route", "status"})
+	ActiveStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "fsb_active_streams",
+		Help: "Streams being served.",
+	})
+	WorkerActiveStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fsb_worker_active_streams",
+		Help: "Streams a worker downloads chunks for.",
+	}, []string{"worker", "username"})
+	DownloadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fsb_upload_get_file_duration_seconds",
+		Help:    "Latency of the upload.getFile requests of a worker.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"worker", "username"})
+	DownloadErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fsb_upload_get_file_errors_total",
+		Help: "Failed upload.getFile requests of a worker.",
+	}, []string{"worker", "username"})
+	FloodWaits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fsb_flood_waits_total",
+		Help: "FLOOD_WAIT errors received by a worker.",
+	}, []string{"worker", "username"})
+	FloodWaitSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fsb_flood_wait_seconds_total",
+		Help: "Seconds a worker was told to wait by FLOOD_WAIT errors.",
+	}, []string{"worker", "username"})
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fsb_cache_requests_total",
+		Help: "Cache lookups, by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+	LinksGenerated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "fsb_links_generated_total",
+		Help: "Stream links sent to users.",
+	})
+)
+
+// CacheResult returns the result label of a cache lookup.
+func CacheResult(hit bool) string {
+	if hit {
+		return "hit"
+	}
+	return "miss"
+}
+
+// Value returns the current value of a counter or gauge, summed over every
+// series for vectors.
+func Value(c prometheus.Collector) float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	var sum float64
+	for m := range ch {
+		var metric dto.Metric
+		if err := m.Write(&metric); err != nil {
+			continue
+		}
+		switch {
+		case metric.Counter != nil:
+			sum += metric.Counter.GetValue()
+		case metric.Gauge != nil:
+			sum += metric.Gauge.GetValue()
+		}
+	}
+	return sum
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/types"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fileETag is a strong validator for the file. Telegram documents never
+// change once uploaded, so the document ID and size identify the content.
+func fileETag(file *types.File) string {
+	return fmt.Sprintf(`"%x-%x"`, file.ID, file.FileSize)
+}
+
+// fileModTime is the date of the log channel message, truncated to whole
+// seconds like every HTTP date.
+func fileModTime(file *types.File) time.Time {
+	if file.Date == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(file.Date), 0).UTC()
+}
+
+// checkPreconditions sets the validators of the file and evaluates the
+// conditional headers of the request (RFC 7232). It returns done when a
+// 304 has already been written, and whether the Range header should be
+// honoured according to If-Range.
+func checkPreconditions(ctx *gin.Context, file *types.File) (done bool, useRange bool) {
+	r := ctx.Request
+	etag := fileETag(file)
+	modTime := fileModTime(file)
+
+	ctx.Header("ETag", etag)
+	if !modTime.IsZero() {
+		ctx.Header("Last-Modified", modTime.Format(http.TimeFormat))
+	}
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		if inm := r.Header.Get("If-None-Match"); inm != "" {
+			if etagListMatches(inm, etag, false) {
+				ctx.Status(http.StatusNotModified)
+				return true, false
+			}
+		} else if notModifiedSince(r.Header.Get("If-Modified-Since"), modTime) {
+			ctx.Status(http.StatusNotModified)
+			return true, false
+		}
+	}
+
+	if r.Header.Get("Range") == "" {
+		return false, false
+	}
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return false, true
+	}
+	if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+		// If-Range requires the strong comparison
+		return false, etagListMatches(ir, etag, true)
+	}
+	t, err := http.ParseTime(ir)
+	if err != nil || modTime.IsZero() {
+		return false, false
+	}
+	return false, t.Equal(modTime)
+}
+
+func notModifiedSince(ims string, modTime time.Time) bool {
+	if ims == "" || modTime.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !modTime.After(t)
+}
+
+// etagListMatches reports whether any entity tag of the comma separated
+// header value matches etag.
+func etagListMatches(header string, etag string, strong bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return !strong
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if strong {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
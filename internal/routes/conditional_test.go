@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEtagListMatches(t *testing.T) {
+	const etag = `"2a-400"`
+	tests := []struct {
+		name   string
+		header string
+		strong bool
+		want   bool
+	}{
+		{"exact", `"2a-400"`, false, true},
+		{"exact strong", `"2a-400"`, true, true},
+		{"other", `"2a-401"`, false, false},
+		{"weak", `W/"2a-400"`, false, true},
+		{"weak strong", `W/"2a-400"`, true, false},
+		{"list", `"abc", "2a-400"`, false, true},
+		{"list without spaces", `"abc","2a-400"`, true, true},
+		{"list without match", `"abc", W/"def"`, false, false},
+		{"wildcard", `*`, false, true},
+		{"wildcard strong", `*`, true, false},
+		{"unquoted", `2a-400`, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagListMatches(tt.header, etag, tt.strong); got != tt.want {
+				t.Errorf("etagListMatches(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	file := &types.File{ID: 42, FileSize: 1024, Date: int(modTime.Unix())}
+	etag := fileETag(file)
+	lastModified := modTime.Format(http.TimeFormat)
+	before := modTime.Add(-time.Hour).Format(http.TimeFormat)
+	after := modTime.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name         string
+		method       string
+		headers      map[string]string
+		wantDone     bool
+		wantUseRange bool
+	}{
+		{"no headers", http.MethodGet, nil, false, false},
+		{"range", http.MethodGet, map[string]string{"Range": "bytes=0-1"}, false, true},
+		{"if-none-match", http.MethodGet, map[string]string{"If-None-Match": etag}, true, false},
+		{"if-none-match head", http.MethodHead, map[string]string{"If-None-Match": etag}, true, false},
+		{"if-none-match weak", http.MethodGet, map[string]string{"If-None-Match": "W/" + etag}, true, false},
+		{"if-none-match other", http.MethodGet, map[string]string{"If-None-Match": `"other"`}, false, false},
+		{"if-none-match post", http.MethodPost, map[string]string{"If-None-Match": etag}, false, false},
+		{"if-modified-since same", http.MethodGet, map[string]string{"If-Modified-Since": lastModified}, true, false},
+		{"if-modified-since after", http.MethodGet, map[string]string{"If-Modified-Since": after}, true, false},
+		{"if-modified-since before", http.MethodGet, map[string]string{"If-Modified-Since": before}, false, false},
+		{"if-modified-since invalid", http.MethodGet, map[string]string{"If-Modified-Since": "yesterday"}, false, false},
+		// If-None-Match takes precedence over If-Modified-Since
+		{"if-none-match other with if-modified-since", http.MethodGet, map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified}, false, false},
+		{"if-range etag", http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": etag}, false, true},
+		{"if-range weak etag", http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": "W/" + etag}, false, false},
+		{"if-range other etag", http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": `"other"`}, false, false},
+		{"if-range date", http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": lastModified}, false, true},
+		{"if-range other date", http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": before}, false, false},
+		{"if-range invalid", http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": "yesterday"}, false, false},
+		{"if-range without range", http.MethodGet, map[string]string{"If-Range": etag}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(tt.method, "/stream/1", nil)
+			for key, value := range tt.headers {
+				ctx.Request.Header.Set(key, value)
+			}
+			done, useRange := checkPreconditions(ctx, file)
+			if done != tt.wantDone || useRange != tt.wantUseRange {
+				t.Errorf("checkPreconditions() = %v, %v, want %v, %v", done, useRange, tt.wantDone, tt.wantUseRange)
+			}
+			if tt.wantDone && ctx.Writer.Status() != http.StatusNotModified {
+				t.Errorf("status = %d, want %d", ctx.Writer.Status(), http.StatusNotModified)
+			}
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+			if got := w.Header().Get("Last-Modified"); got != lastModified {
+				t.Errorf("Last-Modified = %q, want %q", got, lastModified)
+			}
+		})
+	}
+}
+
+func TestCheckPreconditionsWithoutDate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	file := &types.File{ID: 42, FileSize: 1024}
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/stream/1", nil)
+	ctx.Request.Header.Set("If-Modified-Since", time.Now().Format(http.TimeFormat))
+	if done, _ := checkPreconditions(ctx, file); done {
+		t.Errorf("files without a date must never be reported as not modified")
+	}
+	if got := w.Header().Get("Last-Modified"); got != "" {
+		t.Errorf("Last-Modified = %q, want none", got)
+	}
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/metrics"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func (e *allRoutes) LoadMetrics(r *Route) {
+	log := e.log.Named("Metrics")
+	defer log.Info("Loaded metrics route")
+	handlers := []gin.HandlerFunc{gin.WrapH(promhttp.Handler())}
+	if config.ValueOf.MetricsToken != "" {
+		handlers = append([]gin.HandlerFunc{tokenAuth(config.ValueOf.MetricsToken)}, handlers...)
+	} else {
+		log.Info("METRICS_TOKEN not set, /metrics is readable by anyone")
+	}
+	r.Engine.GET("/metrics", handlers...)
+}
+
+// RecordMetrics counts the requests and the bytes served per route and
+// status. It must be registered before the routes.
+func RecordMetrics(ctx *gin.Context) {
+	ctx.Next()
+	route := ctx.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := strconv.Itoa(ctx.Writer.Status())
+	metrics.Requests.WithLabelValues(route, status).Inc()
+	metrics.ResponseBytes.WithLabelValues(route, status).Add(float64(max(ctx.Writer.Size(), 0)))
+}
@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPlaylistFiles caps the files of a playlist, each one costs a message
+// lookup.
+const maxPlaylistFiles = 100
+
+func (e *allRoutes) LoadPlaylist(r *Route) {
+	log := e.log.Named("Playlist")
+	defer log.Info("Loaded playlist route")
+	r.Engine.GET("/playlist", getPlaylistRoute)
+}
+
+// getPlaylistRoute answers with an M3U playlist of the stream links of
+// the files of an album.
+func getPlaylistRoute(ctx *gin.Context) {
+	w := ctx.Writer
+
+	ids := ctx.Query("ids")
+	authHash := ctx.Query("hash")
+	if ids == "" || authHash == "" {
+		http.Error(w, "missing ids or hash param", http.StatusBadRequest)
+		return
+	}
+	expiry, ok := linkExpiry(ctx)
+	if !ok {
+		return
+	}
+	if !utils.CheckPlaylistHash(authHash, ids, expiry) {
+		http.Error(w, "invalid hash", http.StatusBadRequest)
+		return
+	}
+	parts := strings.Split(ids, ",")
+	if len(parts) > maxPlaylistFiles {
+		http.Error(w, "too many files", http.StatusBadRequest)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n")
+	files := 0
+	for _, part := range parts {
+		messageID, err := strconv.Atoi(part)
+		if err != nil {
+			http.Error(w, "invalid ids param", http.StatusBadRequest)
+			return
+		}
+		if revoked(ctx, messageID) {
+			continue
+		}
+		_, file, err := fileFromMessage(ctx, messageID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		files++
+		fmt.Fprintf(&sb, "#EXTINF:-1,%s\n%s\n", strings.ReplaceAll(file.FileName, "\n", " "), utils.GetStreamLink(messageID, file, expiry))
+	}
+
+	if files == 0 {
+		http.Error(w, "The links of these files were revoked.", http.StatusGone)
+		return
+	}
+
+	ctx.Header("Content-Disposition", "inline; filename=\"playlist.m3u\"")
+	ctx.Data(http.StatusOK, "audio/x-mpegurl", []byte(sb.String()))
+}
@@ -1,14 +1,22 @@
 package routes
 
 import (
+	"EverythingSuckz/fsb/config"
 	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/types"
 	"EverythingSuckz/fsb/internal/utils"
+	"cmp"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/gotd/td/tg"
 	range_parser "github.com/quantumsheep/range-parser"
 	"go.uber.org/zap"
 
@@ -17,6 +25,10 @@ import (
 
 var log *zap.Logger
 
+// maxRanges is the most ranges a request is answered with, once overlapping
+// and adjacent ones are merged.
+const maxRanges = 32
+
 func (e *allRoutes) LoadHome(r *Route) {
 	log = e.log.Named("Stream")
 	defer log.Info("Loaded stream route")
@@ -40,61 +52,85 @@ func getStreamRoute(ctx *gin.Context) {
 		return
 	}
 
-	worker := bot.GetNextWorker()
+	expiry, ok := linkExpiry(ctx)
+	if !ok {
+		return
+	}
+	if revoked(ctx, messageID) {
+		http.Error(w, "This link was revoked.", http.StatusGone)
+		return
+	}
 
-	file, err := utils.FileFromMessage(ctx, worker.Client, messageID)
+	worker, file, err := fileFromMessage(ctx, messageID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	expectedHash := utils.PackFile(
+	if !utils.CheckHash(
+		authHash,
 		file.FileName,
 		file.FileSize,
 		file.MimeType,
 		file.ID,
-	)
-	if !utils.CheckHash(authHash, expectedHash) {
+		expiry,
+	) {
 		http.Error(w, "invalid hash", http.StatusBadRequest)
 		return
 	}
 
-	// for photo messages
-	if file.FileSize == 0 {
-		res, err := worker.Client.API().UploadGetFile(ctx, &tg.UploadGetFileRequest{
-			Location: file.Location,
-			Offset:   0,
-			Limit:    1024 * 1024,
-		})
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		result, ok := res.(*tg.UploadFile)
-		if !ok {
-			http.Error(w, "unexpected response", http.StatusInternalServerError)
-			return
-		}
-		fileBytes := result.GetBytes()
-		ctx.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", file.FileName))
-		if r.Method != "HEAD" {
-			ctx.Data(http.StatusOK, file.MimeType, fileBytes)
-		}
+	done, useRange := checkPreconditions(ctx, file)
+	if done {
 		return
 	}
 
 	ctx.Header("Accept-Ranges", "bytes")
 	var start, end int64
 	rangeHeader := r.Header.Get("Range")
+	if !useRange {
+		// a stale If-Range validator means the client gets the whole file
+		rangeHeader = ""
+	}
+
+	mimeType := file.MimeType
+
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	disposition := "inline"
 
-	if rangeHeader == "" {
+	if ctx.Query("d") == "true" {
+		disposition = "attachment"
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, file.FileName))
+
+	var ranges []*range_parser.Range
+	if rangeHeader != "" {
+		// the parser does not trim the optional whitespace allowed after each comma
+		ranges, err = range_parser.Parse(file.FileSize, strings.ReplaceAll(rangeHeader, " ", ""))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ranges = mergeRanges(ranges)
+		if len(ranges) > maxRanges {
+			// every range opens its own reader, which downloads at least a
+			// whole chunk. Like net/http does for ranges adding up to more
+			// than the file, the Range header is ignored.
+			log.Info("Too many ranges, sending the whole file", zap.Int("ranges", len(ranges)))
+			ranges = nil
+		}
+	}
+
+	if len(ranges) == 0 {
 		start = 0
 		end = file.FileSize - 1
 		w.WriteHeader(http.StatusOK)
 	} else {
-		ranges, err := range_parser.Parse(file.FileSize, r.Header.Get("Range"))
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if len(ranges) > 1 {
+			serveMultipartRanges(ctx, streamWorkers(worker, file), messageID, file, ranges, mimeType)
 			return
 		}
 		start = ranges[0].Start
@@ -105,27 +141,160 @@ func getStreamRoute(ctx *gin.Context) {
 	}
 
 	contentLength := end - start + 1
-	mimeType := file.MimeType
-
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
-	}
+	workers := streamWorkers(worker, file)
 
 	ctx.Header("Content-Type", mimeType)
 	ctx.Header("Content-Length", strconv.FormatInt(contentLength, 10))
 
-	disposition := "inline"
+	if r.Method != "HEAD" {
+		lr, _ := utils.NewTelegramReader(r.Context(), workers, messageID, file, start, end, contentLength)
+		defer lr.Close()
+		if _, err := io.CopyN(w, lr, contentLength); err != nil {
+			log.Error("Error while copying stream", zap.Error(err))
+		}
+	}
+}
 
-	if ctx.Query("d") == "true" {
-		disposition = "attachment"
+// fileFromMessage fetches the file of the log channel message with the
+// next worker, or with the userbot if the worker can't.
+func fileFromMessage(ctx *gin.Context, messageID int) (*bot.Worker, *types.File, error) {
+	worker := bot.GetNextWorker()
+	file, err := utils.FileFromMessage(ctx, worker.Client(), messageID)
+	if fallback := bot.GetFallbackWorker(); err != nil && fallback != nil && fallback != worker {
+		// the bot may not be able to read the log channel, the userbot can
+		log.Debug("Retrying with the userbot", zap.Int("workerID", worker.ID), zap.Error(err))
+		worker = fallback
+		file, err = utils.FileFromMessage(ctx, worker.Client(), messageID)
 	}
+	return worker, file, err
+}
 
-	ctx.Header("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, file.FileName))
+// revoked reports whether the links of the log channel message were
+// revoked. Links stay usable if the database can't tell.
+func revoked(ctx *gin.Context, messageID int) bool {
+	revoked, err := database.IsRevoked(messageID)
+	if err != nil {
+		log.Error("Failed to check link revocation", zap.Int("messageID", messageID), zap.Error(err))
+	}
+	return revoked
+}
 
-	if r.Method != "HEAD" {
-		lr, _ := utils.NewTelegramReader(ctx, worker.Client, file.Location, start, end, contentLength)
-		if _, err := io.CopyN(w, lr, contentLength); err != nil {
+// linkExpiry parses the exp param of a link and rejects expired links.
+// Links without exp never expire.
+func linkExpiry(ctx *gin.Context) (int64, bool) {
+	exp := ctx.Query("exp")
+	if exp == "" {
+		return 0, true
+	}
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		http.Error(ctx.Writer, "invalid exp param", http.StatusBadRequest)
+		return 0, false
+	}
+	// the expiry is covered by the hash, so tampering with it only
+	// ever gets the link rejected
+	if time.Now().Unix() > expiry {
+		http.Error(ctx.Writer, "This link has expired, send the file to the bot again to get a new one.", http.StatusGone)
+		return 0, false
+	}
+	return expiry, true
+}
+
+// streamWorkers decides which workers serve the chunks of a stream. Large
+// files are striped across every worker, the rest stay on the one picked
+// for the request.
+func streamWorkers(worker *bot.Worker, file *types.File) []*bot.Worker {
+	stripeMinSize := config.ValueOf.StripeMinSize * 1024 * 1024
+	if stripeMinSize <= 0 || file.FileSize < stripeMinSize {
+		return []*bot.Worker{worker}
+	}
+	return bot.GetStripeWorkers(worker)
+}
+
+// serveMultipartRanges answers a request for several byte ranges with a
+// multipart/byteranges body as described in RFC 7233, Appendix A.
+// Each part is streamed by its own telegram reader. The ranges must not
+// overlap, see mergeRanges.
+func serveMultipartRanges(ctx *gin.Context, workers []*bot.Worker, messageID int, file *types.File, ranges []*range_parser.Range, mimeType string) {
+	w := ctx.Writer
+	r := ctx.Request
+
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	ctx.Header("Content-Type", "multipart/byteranges; boundary="+boundary)
+	ctx.Header("Content-Length", strconv.FormatInt(multipartSize(ranges, mimeType, file.FileSize, boundary), 10))
+	log.Info("Multipart ranges", zap.Int("parts", len(ranges)), zap.Int64("fileSize", file.FileSize))
+	w.WriteHeader(http.StatusPartialContent)
+
+	if r.Method == "HEAD" {
+		return
+	}
+
+	mw := multipart.NewWriter(w)
+	mw.SetBoundary(boundary)
+	for _, ra := range ranges {
+		part, err := mw.CreatePart(rangePartHeader(ra, mimeType, file.FileSize))
+		if err != nil {
+			log.Error("Error while writing part header", zap.Error(err))
+			return
+		}
+		length := ra.End - ra.Start + 1
+		lr, _ := utils.NewTelegramReader(r.Context(), workers, messageID, file, ra.Start, ra.End, length)
+		_, err = io.CopyN(part, lr, length)
+		lr.Close()
+		if err != nil {
 			log.Error("Error while copying stream", zap.Error(err))
+			return
 		}
 	}
+	if err := mw.Close(); err != nil {
+		log.Error("Error while closing multipart writer", zap.Error(err))
+	}
+}
+
+// mergeRanges sorts the ranges and coalesces the overlapping and adjacent
+// ones (RFC 7233, section 4.1), so that no byte is downloaded twice and the
+// ranges never add up to more than the file.
+func mergeRanges(ranges []*range_parser.Range) []*range_parser.Range {
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b *range_parser.Range) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	merged := make([]*range_parser.Range, 0, len(sorted))
+	for _, ra := range sorted {
+		if last := len(merged) - 1; last >= 0 && ra.Start <= merged[last].End+1 {
+			merged[last].End = max(merged[last].End, ra.End)
+			continue
+		}
+		merged = append(merged, &range_parser.Range{Start: ra.Start, End: ra.End})
+	}
+	return merged
+}
+
+func rangePartHeader(ra *range_parser.Range, mimeType string, fileSize int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", ra.Start, ra.End, fileSize)},
+		"Content-Type":  {mimeType},
+	}
+}
+
+// multipartSize returns the exact length of the multipart/byteranges body
+// so that Content-Length can be sent before any part is fetched.
+func multipartSize(ranges []*range_parser.Range, mimeType string, fileSize int64, boundary string) int64 {
+	var cw countingWriter
+	mw := multipart.NewWriter(&cw)
+	mw.SetBoundary(boundary)
+	var bodySize int64
+	for _, ra := range ranges {
+		mw.CreatePart(rangePartHeader(ra, mimeType, fileSize))
+		bodySize += ra.End - ra.Start + 1
+	}
+	mw.Close()
+	return int64(cw) + bodySize
+}
+
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
 }
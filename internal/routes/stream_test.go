@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	range_parser "github.com/quantumsheep/range-parser"
+)
+
+func TestMultipartSize(t *testing.T) {
+	const fileSize = 10000
+	content := bytes.Repeat([]byte("0123456789"), fileSize/10)
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"single", "bytes=0-99"},
+		{"two", "bytes=0-0,9000-9999"},
+		{"suffix", "bytes=0-10,-500"},
+		{"open ended", "bytes=100-199,9990-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := range_parser.Parse(fileSize, tt.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			for _, ra := range ranges {
+				part, err := mw.CreatePart(rangePartHeader(ra, "video/mp4", fileSize))
+				if err != nil {
+					t.Fatal(err)
+				}
+				part.Write(content[ra.Start : ra.End+1])
+			}
+			mw.Close()
+			if got := multipartSize(ranges, "video/mp4", fileSize, mw.Boundary()); got != int64(body.Len()) {
+				t.Fatalf("multipartSize() = %d, the body is %d bytes", got, body.Len())
+			}
+
+			// the parts must read back as the requested ranges
+			mr := multipart.NewReader(&body, mw.Boundary())
+			for _, ra := range ranges {
+				part, err := mr.NextPart()
+				if err != nil {
+					t.Fatal(err)
+				}
+				header := rangePartHeader(ra, "video/mp4", fileSize)
+				if got := part.Header.Get("Content-Range"); got != header.Get("Content-Range") {
+					t.Errorf("Content-Range = %q, want %q", got, header.Get("Content-Range"))
+				}
+				data, err := io.ReadAll(part)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, content[ra.Start:ra.End+1]) {
+					t.Errorf("part of range %d-%d holds the wrong bytes", ra.Start, ra.End)
+				}
+			}
+			if _, err := mr.NextPart(); err != io.EOF {
+				t.Errorf("expected %d parts, got more", len(ranges))
+			}
+		})
+	}
+}
+
+func TestRangePartHeader(t *testing.T) {
+	header := rangePartHeader(&range_parser.Range{Start: 0, End: 499}, "video/mp4", 1000)
+	if got := header.Get("Content-Range"); got != "bytes 0-499/1000" {
+		t.Errorf("Content-Range = %q", got)
+	}
+	if got := header.Get("Content-Type"); got != "video/mp4" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if len(header) != 2 {
+		t.Errorf("unexpected header %v", header)
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"single", "bytes=0-99", "0-99"},
+		{"disjoint", "bytes=0-9,20-29", "0-9,20-29"},
+		{"unsorted", "bytes=20-29,0-9", "0-9,20-29"},
+		{"overlapping", "bytes=0-49,25-99", "0-99"},
+		{"adjacent", "bytes=0-9,10-19", "0-19"},
+		{"contained", "bytes=0-99,10-19", "0-99"},
+		{"duplicates", "bytes=5-5,5-5,5-5", "5-5"},
+		{"suffix overlapping", "bytes=9999000-9999499,-1000", "9999000-9999999"},
+		{"one byte per chunk", "bytes=0-0,1048576-1048576,2097152-2097152", "0-0,1048576-1048576,2097152-2097152"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := range_parser.Parse(10000000, tt.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			merged := mergeRanges(ranges)
+			got := make([]string, len(merged))
+			for i, ra := range merged {
+				got[i] = fmt.Sprintf("%d-%d", ra.Start, ra.End)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("mergeRanges(%q) = %s, want %s", tt.header, strings.Join(got, ","), tt.want)
+			}
+		})
+	}
+}
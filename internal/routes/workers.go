@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/types"
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (e *allRoutes) LoadWorkers(r *Route) {
+	log := e.log.Named("Workers")
+	if config.ValueOf.AdminToken == "" {
+		log.Info("ADMIN_TOKEN not set, worker routes disabled")
+		return
+	}
+	defer log.Info("Loaded worker routes")
+	workers := r.Engine.Group("/workers", tokenAuth(config.ValueOf.AdminToken))
+	workers.GET("", listWorkersRoute)
+	workers.POST("", addWorkerRoute)
+	workers.POST("/:worker/disable", disableWorkerRoute)
+	workers.POST("/:worker/enable", enableWorkerRoute)
+	workers.DELETE("/:worker", removeWorkerRoute)
+}
+
+// tokenAuth only lets requests carrying "Authorization: Bearer <token>" through.
+func tokenAuth(expected string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, types.MessageResponse{Message: "unauthorized", Ok: false})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func workerResponse(worker *bot.Worker) types.WorkerResponse {
+	return types.WorkerResponse{
+		ID:            worker.ID,
+		Username:      worker.Self.Username,
+		Status:        worker.Status(),
+		ActiveStreams: worker.ActiveStreams(),
+		FloodWait:     int64(math.Ceil(worker.FloodWait().Seconds())),
+	}
+}
+
+func listWorkersRoute(ctx *gin.Context) {
+	res := types.WorkersResponse{Workers: []types.WorkerResponse{}, Ok: true}
+	for _, worker := range bot.Workers.List() {
+		res.Workers = append(res.Workers, workerResponse(worker))
+	}
+	tokens, err := database.GetWorkerTokens()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, types.MessageResponse{Message: err.Error(), Ok: false})
+		return
+	}
+	for _, token := range tokens {
+		if token.State == database.WorkerDisabled {
+			res.Workers = append(res.Workers, types.WorkerResponse{Username: token.Username, Status: string(token.State)})
+		}
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+func addWorkerRoute(ctx *gin.Context) {
+	var body struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, types.MessageResponse{Message: err.Error(), Ok: false})
+		return
+	}
+	worker, err := bot.Workers.AddToken(body.Token)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, types.MessageResponse{Message: err.Error(), Ok: false})
+		return
+	}
+	ctx.JSON(http.StatusCreated, workerResponse(worker))
+}
+
+func disableWorkerRoute(ctx *gin.Context) {
+	worker, err := bot.Workers.Disable(ctx.Param("worker"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, types.MessageResponse{Message: err.Error(), Ok: false})
+		return
+	}
+	res := workerResponse(worker)
+	res.Status = "draining"
+	ctx.JSON(http.StatusOK, res)
+}
+
+func enableWorkerRoute(ctx *gin.Context) {
+	worker, err := bot.Workers.Enable(ctx.Param("worker"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, types.MessageResponse{Message: err.Error(), Ok: false})
+		return
+	}
+	ctx.JSON(http.StatusOK, workerResponse(worker))
+}
+
+func removeWorkerRoute(ctx *gin.Context) {
+	_, err := bot.Workers.Remove(ctx.Param("worker"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, types.MessageResponse{Message: err.Error(), Ok: false})
+		return
+	}
+	ctx.JSON(http.StatusOK, types.MessageResponse{Message: "worker removed", Ok: true})
+}
@@ -1,7 +1,9 @@
 package types
 
 import (
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"reflect"
 	"strconv"
@@ -15,6 +17,8 @@ type File struct {
 	FileName string
 	MimeType string
 	ID       int64
+	// Date is the unix time of the log channel message holding the file.
+	Date int
 }
 
 type HashableFileStruct struct {
@@ -22,11 +26,58 @@ type HashableFileStruct struct {
 	FileSize int64
 	MimeType string
 	FileID   int64
+	// Expiry is the unix time after which the link is rejected, 0 never expires.
+	Expiry int64
 }
 
+// Pack is the legacy unkeyed hash of the file properties. It is only kept
+// to verify links generated before links were signed.
 func (f *HashableFileStruct) Pack() string {
 	hasher := md5.New()
-	val := reflect.ValueOf(*f)
+	// legacy links never had an expiry
+	hasher.Write([]byte(f.FileName))
+	hasher.Write([]byte(strconv.FormatInt(f.FileSize, 10)))
+	hasher.Write([]byte(f.MimeType))
+	hasher.Write([]byte(strconv.FormatInt(f.FileID, 10)))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// Sign returns the HMAC-SHA256 of the file properties keyed with secret.
+func (f *HashableFileStruct) Sign(secret []byte) string {
+	return sign(secret, *f)
+}
+
+// HashablePlaylistStruct identifies the files of a playlist link.
+type HashablePlaylistStruct struct {
+	// Kind keeps playlist signatures apart from file signatures.
+	Kind string
+	// MessageIDs are the comma separated log channel messages of the files.
+	MessageIDs string
+	Expiry     int64
+}
+
+func NewHashablePlaylist(messageIDs string, expiry int64) *HashablePlaylistStruct {
+	return &HashablePlaylistStruct{Kind: "playlist", MessageIDs: messageIDs, Expiry: expiry}
+}
+
+// Sign returns the HMAC-SHA256 of the playlist keyed with secret.
+func (p *HashablePlaylistStruct) Sign(secret []byte) string {
+	return sign(secret, *p)
+}
+
+func sign(secret []byte, v any) string {
+	mac := hmac.New(sha256.New, secret)
+	for _, fieldValue := range fields(v) {
+		mac.Write(fieldValue)
+		// separate the fields so that they can't be shifted into each other
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func fields(v any) [][]byte {
+	val := reflect.ValueOf(v)
+	fields := make([][]byte, 0, val.NumField())
 	for i := 0; i < val.NumField(); i++ {
 		field := val.Field(i)
 
@@ -38,7 +89,7 @@ func (f *HashableFileStruct) Pack() string {
 			fieldValue = []byte(strconv.FormatInt(field.Int(), 10))
 		}
 
-		hasher.Write(fieldValue)
+		fields = append(fields, fieldValue)
 	}
-	return hex.EncodeToString(hasher.Sum(nil))
+	return fields
 }
@@ -0,0 +1,49 @@
+package types
+
+import "testing"
+
+func TestHashableFileSign(t *testing.T) {
+	base := HashableFileStruct{FileName: "video.mp4", FileSize: 1024, MimeType: "video/mp4", FileID: 42}
+	secret := []byte("secret")
+	signature := base.Sign(secret)
+	if len(signature) != 64 {
+		t.Fatalf("expected a hex encoded SHA-256, got %q", signature)
+	}
+	if again := base.Sign(secret); again != signature {
+		t.Fatalf("signature is not deterministic: %q != %q", again, signature)
+	}
+
+	tests := []struct {
+		name   string
+		file   HashableFileStruct
+		secret string
+	}{
+		{"other secret", base, "other"},
+		{"other name", HashableFileStruct{FileName: "video.mkv", FileSize: 1024, MimeType: "video/mp4", FileID: 42}, "secret"},
+		{"other size", HashableFileStruct{FileName: "video.mp4", FileSize: 1025, MimeType: "video/mp4", FileID: 42}, "secret"},
+		{"other type", HashableFileStruct{FileName: "video.mp4", FileSize: 1024, MimeType: "video/webm", FileID: 42}, "secret"},
+		{"other ID", HashableFileStruct{FileName: "video.mp4", FileSize: 1024, MimeType: "video/mp4", FileID: 43}, "secret"},
+		{"with expiry", HashableFileStruct{FileName: "video.mp4", FileSize: 1024, MimeType: "video/mp4", FileID: 42, Expiry: 1700000000}, "secret"},
+		// without separators "video.mp41024" would sign the same as below
+		{"shifted fields", HashableFileStruct{FileName: "video.mp41", FileSize: 24, MimeType: "video/mp4", FileID: 42}, "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.file.Sign([]byte(tt.secret)); got == signature {
+				t.Errorf("expected a different signature than the base file")
+			}
+		})
+	}
+}
+
+func TestHashableFilePack(t *testing.T) {
+	file := HashableFileStruct{FileName: "video.mp4", FileSize: 1024, MimeType: "video/mp4", FileID: 42}
+	withExpiry := file
+	withExpiry.Expiry = 1700000000
+	if file.Pack() != withExpiry.Pack() {
+		t.Errorf("legacy hashes must not depend on the expiry")
+	}
+	if len(file.Pack()) != 32 {
+		t.Errorf("expected a hex encoded MD5, got %q", file.Pack())
+	}
+}
@@ -6,3 +6,23 @@ type RootResponse struct {
 	Uptime  string `json:"uptime"`
 	Version string `json:"version"`
 }
+
+type MessageResponse struct {
+	Message string `json:"message"`
+	Ok      bool   `json:"ok"`
+}
+
+type WorkerResponse struct {
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	Status        string `json:"status"`
+	ActiveStreams int64  `json:"active_streams"`
+	// FloodWait is the number of seconds left before the worker may
+	// download again.
+	FloodWait int64 `json:"flood_wait,omitempty"`
+}
+
+type WorkersResponse struct {
+	Workers []WorkerResponse `json:"workers"`
+	Ok      bool             `json:"ok"`
+}
@@ -3,16 +3,145 @@ package utils
 import (
 	"EverythingSuckz/fsb/config"
 	"EverythingSuckz/fsb/internal/types"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func PackFile(fileName string, fileSize int64, mimeType string, fileID int64) string {
-	return (&types.HashableFileStruct{FileName: fileName, FileSize: fileSize, MimeType: mimeType, FileID: fileID}).Pack()
+// PackFile signs the file properties and the link expiry with the current
+// (first) secret.
+func PackFile(fileName string, fileSize int64, mimeType string, fileID int64, expiry int64) string {
+	file := &types.HashableFileStruct{FileName: fileName, FileSize: fileSize, MimeType: mimeType, FileID: fileID, Expiry: expiry}
+	return file.Sign([]byte(config.ValueOf.HashSecrets[0]))
 }
 
 func GetShortHash(fullHash string) string {
+	if len(fullHash) <= config.ValueOf.HashLength {
+		return fullHash
+	}
 	return fullHash[:config.ValueOf.HashLength]
 }
 
-func CheckHash(inputHash string, expectedHash string) bool {
-	return inputHash == GetShortHash(expectedHash)
+// CheckHash reports whether inputHash was issued for the file and expiry by
+// any of the configured secrets, or is a legacy hash while LEGACY_HASH is
+// enabled.
+func CheckHash(inputHash string, fileName string, fileSize int64, mimeType string, fileID int64, expiry int64) bool {
+	file := &types.HashableFileStruct{FileName: fileName, FileSize: fileSize, MimeType: mimeType, FileID: fileID, Expiry: expiry}
+	valid := checkSignature(inputHash, file.Sign)
+	if config.ValueOf.LegacyHash && expiry == 0 && len(inputHash) == config.ValueOf.LegacyHashLength {
+		// only the length the legacy links were issued with is accepted,
+		// shorter prefixes would be easy to guess
+		legacy := *file
+		if isPhoto(fileName, mimeType, fileID) {
+			// photos used to be hashed without their size
+			legacy.FileSize = 0
+		}
+		valid |= subtle.ConstantTimeCompare([]byte(inputHash), []byte(legacy.Pack()[:len(inputHash)]))
+	}
+	return valid == 1
+}
+
+// isPhoto reports whether the file properties are the ones FileFromMedia
+// gives photos.
+func isPhoto(fileName string, mimeType string, fileID int64) bool {
+	return mimeType == "image/jpeg" && fileName == fmt.Sprintf("photo_%d.jpg", fileID)
+}
+
+// checkSignature returns 1 if inputHash was signed with any of the
+// configured secrets, 0 otherwise.
+func checkSignature(inputHash string, sign func(secret []byte) string) int {
+	valid := 0
+	for _, secret := range config.ValueOf.HashSecrets {
+		// keep checking every secret so the timing doesn't reveal which one matched
+		valid |= subtle.ConstantTimeCompare([]byte(inputHash), []byte(GetShortHash(sign([]byte(secret)))))
+	}
+	return valid
+}
+
+// CheckPlaylistHash reports whether inputHash was issued for the playlist
+// of the comma separated message IDs and expiry.
+func CheckPlaylistHash(inputHash string, messageIDs string, expiry int64) bool {
+	return checkSignature(inputHash, types.NewHashablePlaylist(messageIDs, expiry).Sign) == 1
+}
+
+// LinkExpiry returns the unix time a link generated now with the given TTL
+// expires at, 0 if it never does.
+func LinkExpiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).Unix()
+}
+
+// GetStreamLink builds the signed stream link of the file stored in the log
+// channel message.
+func GetStreamLink(messageID int, file *types.File, expiry int64) string {
+	hash := GetShortHash(PackFile(
+		file.FileName,
+		file.FileSize,
+		file.MimeType,
+		file.ID,
+		expiry,
+	))
+	link := fmt.Sprintf("%s/stream/%d?hash=%s", config.ValueOf.Host, messageID, hash)
+	if expiry != 0 {
+		link += fmt.Sprintf("&exp=%d", expiry)
+	}
+	return link
+}
+
+// GetPlaylistLink builds the signed link of an M3U playlist with the
+// stream links of the files stored in the log channel messages.
+func GetPlaylistLink(messageIDs []int, expiry int64) string {
+	ids := make([]string, len(messageIDs))
+	for i, id := range messageIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	joined := strings.Join(ids, ",")
+	hash := GetShortHash(types.NewHashablePlaylist(joined, expiry).Sign([]byte(config.ValueOf.HashSecrets[0])))
+	link := fmt.Sprintf("%s/playlist?ids=%s&hash=%s", config.ValueOf.Host, joined, hash)
+	if expiry != 0 {
+		link += fmt.Sprintf("&exp=%d", expiry)
+	}
+	return link
+}
+
+// ParseTTL parses a link TTL such as "90m", "12h" or "7d". Zero means the
+// link never expires.
+func ParseTTL(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, err
+		}
+		if n < 0 {
+			return 0, errors.New("ttl can't be negative")
+		}
+		// ParseFloat accepts NaN and Inf, and huge values overflow
+		if math.IsNaN(n) || n > float64(math.MaxInt64)/float64(24*time.Hour) {
+			return 0, fmt.Errorf("invalid ttl %q", value)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, errors.New("ttl can't be negative")
+	}
+	return ttl, nil
+}
+
+// FormatTTL describes a link TTL for humans.
+func FormatTTL(ttl time.Duration) string {
+	if ttl <= 0 {
+		return "unlimited"
+	}
+	return strings.TrimSuffix(TimeFormat(uint64(ttl.Seconds())), ", ")
 }
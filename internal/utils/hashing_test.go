@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setHashConfig(t *testing.T, secrets ...string) {
+	t.Helper()
+	previous := *config.ValueOf
+	t.Cleanup(func() {
+		*config.ValueOf = previous
+	})
+	config.ValueOf.HashSecrets = secrets
+	config.ValueOf.HashLength = 16
+	config.ValueOf.LegacyHash = false
+	config.ValueOf.LegacyHashLength = 6
+	config.ValueOf.Host = "http://example.com"
+}
+
+func TestCheckHash(t *testing.T) {
+	setHashConfig(t, "current", "previous")
+	const expiry = 1700000000
+	file := &types.HashableFileStruct{FileName: "video.mp4", FileSize: 1024, MimeType: "video/mp4", FileID: 42, Expiry: expiry}
+	signedWith := func(secret string) string {
+		return GetShortHash(file.Sign([]byte(secret)))
+	}
+
+	tests := []struct {
+		name   string
+		hash   string
+		expiry int64
+		want   bool
+	}{
+		{"current secret", signedWith("current"), expiry, true},
+		{"rotated secret", signedWith("previous"), expiry, true},
+		{"unknown secret", signedWith("unknown"), expiry, false},
+		{"tampered expiry", signedWith("current"), expiry + 3600, false},
+		{"expiry removed", signedWith("current"), 0, false},
+		{"truncated hash", signedWith("current")[:8], expiry, false},
+		{"empty hash", "", expiry, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CheckHash(tt.hash, file.FileName, file.FileSize, file.MimeType, file.FileID, tt.expiry)
+			if got != tt.want {
+				t.Errorf("CheckHash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHashLegacy(t *testing.T) {
+	setHashConfig(t, "current")
+	document := &types.HashableFileStruct{FileName: "video.mp4", FileSize: 1024, MimeType: "video/mp4", FileID: 42}
+	// photos were hashed without their size
+	photo := &types.HashableFileStruct{FileName: "photo_7.jpg", MimeType: "image/jpeg", FileID: 7}
+	const photoSize = 2048
+
+	tests := []struct {
+		name     string
+		legacy   bool
+		file     *types.HashableFileStruct
+		fileSize int64
+		hash     string
+		expiry   int64
+		want     bool
+	}{
+		{"disabled", false, document, 1024, document.Pack()[:6], 0, false},
+		{"issued length", true, document, 1024, document.Pack()[:6], 0, true},
+		{"shorter prefix", true, document, 1024, document.Pack()[:5], 0, false},
+		{"longer prefix", true, document, 1024, document.Pack()[:8], 0, false},
+		{"with expiry", true, document, 1024, document.Pack()[:6], 1700000000, false},
+		{"photo", true, photo, photoSize, photo.Pack()[:6], 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.ValueOf.LegacyHash = tt.legacy
+			got := CheckHash(tt.hash, tt.file.FileName, tt.fileSize, tt.file.MimeType, tt.file.FileID, tt.expiry)
+			if got != tt.want {
+				t.Errorf("CheckHash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetStreamLink(t *testing.T) {
+	setHashConfig(t, "current")
+	file := &types.File{FileName: "video.mp4", FileSize: 1024, MimeType: "video/mp4", ID: 42}
+	hash := GetShortHash(PackFile(file.FileName, file.FileSize, file.MimeType, file.ID, 0))
+	if got, want := GetStreamLink(5, file, 0), "http://example.com/stream/5?hash="+hash; got != want {
+		t.Errorf("GetStreamLink() = %q, want %q", got, want)
+	}
+	hash = GetShortHash(PackFile(file.FileName, file.FileSize, file.MimeType, file.ID, 1700000000))
+	if got, want := GetStreamLink(5, file, 1700000000), "http://example.com/stream/5?hash="+hash+"&exp=1700000000"; got != want {
+		t.Errorf("GetStreamLink() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckPlaylistHash(t *testing.T) {
+	setHashConfig(t, "current", "previous")
+	const expiry = 1700000000
+	link := GetPlaylistLink([]int{5, 6, 7}, expiry)
+	want := "http://example.com/playlist?ids=5,6,7&hash="
+	if !strings.HasPrefix(link, want) || !strings.HasSuffix(link, "&exp=1700000000") {
+		t.Fatalf("GetPlaylistLink() = %q", link)
+	}
+	hash := strings.TrimSuffix(strings.TrimPrefix(link, want), "&exp=1700000000")
+	rotated := GetShortHash(types.NewHashablePlaylist("5,6,7", expiry).Sign([]byte("previous")))
+	// a file whose fields line up with the playlist ones
+	file := GetShortHash(PackFile("playlist", 567, "", 0, expiry))
+
+	tests := []struct {
+		name   string
+		hash   string
+		ids    string
+		expiry int64
+		want   bool
+	}{
+		{"issued", hash, "5,6,7", expiry, true},
+		{"rotated secret", rotated, "5,6,7", expiry, true},
+		{"file added", hash, "5,6,7,8", expiry, false},
+		{"file removed", hash, "5,6", expiry, false},
+		{"reordered", hash, "7,6,5", expiry, false},
+		{"tampered expiry", hash, "5,6,7", expiry + 3600, false},
+		{"file signature", file, "5,6,7", expiry, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckPlaylistHash(tt.hash, tt.ids, tt.expiry); got != tt.want {
+				t.Errorf("CheckPlaylistHash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90m", 90 * time.Minute, false},
+		{"12h", 12 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1.5d", 36 * time.Hour, false},
+		{" 2h ", 2 * time.Hour, false},
+		{"0", 0, false},
+		{"0d", 0, false},
+		{"-1h", 0, true},
+		{"-1d", 0, true},
+		{"NaNd", 0, true},
+		{"Infd", 0, true},
+		{"1e10d", 0, true},
+		{"d", 0, true},
+		{"7", 0, true},
+		{"forever", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTTL(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTTL(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTTL(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
 	"EverythingSuckz/fsb/internal/cache"
 	"EverythingSuckz/fsb/internal/types"
 	"context"
@@ -76,19 +77,34 @@ func FileFromMedia(media tg.MessageMediaClass) (*types.File, error) {
 		if len(sizes) == 0 {
 			return nil, errors.New("photo has no sizes")
 		}
-		photoSize := sizes[len(sizes)-1]
-		size, ok := photoSize.AsNotEmpty()
-		if !ok {
-			return nil, errors.New("photo size is empty")
+		// sizes are sorted from the smallest to the largest, but only the
+		// downloadable ones carry their length in bytes
+		var thumbSize string
+		var fileSize int64
+		for i := len(sizes) - 1; i >= 0 && thumbSize == ""; i-- {
+			switch size := sizes[i].(type) {
+			case *tg.PhotoSize:
+				thumbSize = size.Type
+				fileSize = int64(size.Size)
+			case *tg.PhotoSizeProgressive:
+				if len(size.Sizes) == 0 {
+					continue
+				}
+				thumbSize = size.Type
+				fileSize = int64(size.Sizes[len(size.Sizes)-1])
+			}
+		}
+		if thumbSize == "" {
+			return nil, errors.New("photo has no downloadable size")
 		}
 		location := new(tg.InputPhotoFileLocation)
 		location.ID = photo.GetID()
 		location.AccessHash = photo.GetAccessHash()
 		location.FileReference = photo.GetFileReference()
-		location.ThumbSize = size.GetType()
+		location.ThumbSize = thumbSize
 		return &types.File{
 			Location: location,
-			FileSize: 0, // caller should judge if this is a photo or not
+			FileSize: fileSize,
 			FileName: fmt.Sprintf("photo_%d.jpg", photo.GetID()),
 			MimeType: "image/jpeg",
 			ID:       photo.GetID(),
@@ -97,8 +113,12 @@ func FileFromMedia(media tg.MessageMediaClass) (*types.File, error) {
 	return nil, fmt.Errorf("unexpected type %T", media)
 }
 
+func fileCacheKey(messageID int, client *gotgproto.Client) string {
+	return fmt.Sprintf("file:%d:%d", messageID, client.Self.ID)
+}
+
 func FileFromMessage(ctx context.Context, client *gotgproto.Client, messageID int) (*types.File, error) {
-	key := fmt.Sprintf("file:%d:%d", messageID, client.Self.ID)
+	key := fileCacheKey(messageID, client)
 	log := Logger.Named("GetMessageMedia")
 	var cachedMedia types.File
 	err := cache.GetCache().Get(key, &cachedMedia)
@@ -115,6 +135,7 @@ func FileFromMessage(ctx context.Context, client *gotgproto.Client, messageID in
 	if err != nil {
 		return nil, err
 	}
+	file.Date = message.Date
 	err = cache.GetCache().Set(
 		key,
 		file,
@@ -126,6 +147,33 @@ func FileFromMessage(ctx context.Context, client *gotgproto.Client, messageID in
 	return file, nil
 }
 
+// RefreshFileFromMessage drops the cached file properties and fetches the
+// message again, to get a fresh file reference once the cached one expired.
+func RefreshFileFromMessage(ctx context.Context, client *gotgproto.Client, messageID int) (*types.File, error) {
+	cache.GetCache().Delete(fileCacheKey(messageID, client))
+	return FileFromMessage(ctx, client, messageID)
+}
+
+// EvictFile drops the file properties of the log channel message cached
+// for any of the workers, and the cached chunks of the file.
+func EvictFile(ctx context.Context, messageID int) {
+	if chunkCache := cache.GetChunkCache(); chunkCache != nil && bot.Bot != nil {
+		file, err := FileFromMessage(ctx, bot.Bot, messageID)
+		if err != nil {
+			Logger.Warn("Failed to get the file to evict its chunks", zap.Int("messageID", messageID), zap.Error(err))
+		} else {
+			chunkCache.EvictFile(file.ID)
+		}
+	}
+	workers := bot.Workers.List()
+	if fallback := bot.GetFallbackWorker(); fallback != nil {
+		workers = append(workers, fallback)
+	}
+	for _, worker := range workers {
+		cache.GetCache().Delete(fileCacheKey(messageID, worker.Client()))
+	}
+}
+
 func GetLogChannelPeer(ctx context.Context, api *tg.Client, peerStorage *storage.PeerStorage) (*tg.InputChannel, error) {
 	cachedInputPeer := peerStorage.GetInputPeerById(config.ValueOf.LogChannelID)
 
@@ -159,7 +207,9 @@ func GetLogChannelPeer(ctx context.Context, api *tg.Client, peerStorage *storage
 	return channel.AsInput(), nil
 }
 
-func ForwardMessages(ctx *ext.Context, fromChatId, toChatId int64, messageID int) (*tg.Updates, error) {
+// ForwardMessages forwards the messages to the log channel in a single
+// request and returns the forwarded copies, in the order of messageIDs.
+func ForwardMessages(ctx *ext.Context, fromChatId, toChatId int64, messageIDs ...int) ([]*tg.Message, error) {
 	fromPeer := ctx.PeerStorage.GetInputPeerById(fromChatId)
 	if fromPeer.Zero() {
 		return nil, fmt.Errorf("fromChatId: %d is not a valid peer", fromChatId)
@@ -168,16 +218,46 @@ func ForwardMessages(ctx *ext.Context, fromChatId, toChatId int64, messageID int
 	if err != nil {
 		return nil, err
 	}
+	randomIDs := make([]int64, len(messageIDs))
+	for i := range randomIDs {
+		randomIDs[i] = rand.Int63()
+	}
 	update, err := ctx.Raw.MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
-		RandomID: []int64{rand.Int63()},
+		RandomID: randomIDs,
 		FromPeer: fromPeer,
-		ID:       []int{messageID},
+		ID:       messageIDs,
 		ToPeer:   &tg.InputPeerChannel{ChannelID: toPeer.ChannelID, AccessHash: toPeer.AccessHash},
 	})
 	if err != nil {
 		return nil, err
 	}
-	return update.(*tg.Updates), nil
+	updates, ok := update.(*tg.Updates)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T", update)
+	}
+	// the new messages come in any order, the random IDs tell which
+	// forwarded message is which
+	newIDs := make(map[int64]int, len(randomIDs))
+	forwarded := make(map[int]*tg.Message, len(randomIDs))
+	for _, u := range updates.Updates {
+		switch u := u.(type) {
+		case *tg.UpdateMessageID:
+			newIDs[u.RandomID] = u.ID
+		case *tg.UpdateNewChannelMessage:
+			if message, ok := u.Message.(*tg.Message); ok {
+				forwarded[message.ID] = message
+			}
+		}
+	}
+	messages := make([]*tg.Message, len(randomIDs))
+	for i, randomID := range randomIDs {
+		message, ok := forwarded[newIDs[randomID]]
+		if !ok {
+			return nil, fmt.Errorf("message %d was not forwarded", messageIDs[i])
+		}
+		messages[i] = message
+	}
+	return messages, nil
 }
 
 func IsUserSubscribed(ctx context.Context, client *tg.Client, peerStorage *storage.PeerStorage, userID int64) (bool, error) {
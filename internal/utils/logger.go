@@ -11,6 +11,9 @@ import (
 
 var Logger *zap.Logger
 
+// logFile is kept to close the log file on shutdown, zap can't.
+var logFile *lumberjack.Logger
+
 func InitLogger(debugMode bool) {
 	customTimeEncoder := func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 		enc.AppendString(t.Format("02/01/2006 03:04 PM"))
@@ -24,13 +27,14 @@ func InitLogger(debugMode bool) {
 	fileEncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	fileEncoder := zapcore.NewJSONEncoder(fileEncoderConfig)
 
-	fileWriter := zapcore.AddSync(&lumberjack.Logger{
+	logFile = &lumberjack.Logger{
 		Filename:   "logs/app.log",
 		MaxSize:    10,
 		MaxBackups: 3,
 		MaxAge:     7,
 		Compress:   true,
-	})
+	}
+	fileWriter := zapcore.AddSync(logFile)
 
 	var consoleLevel zapcore.Level
 	if debugMode {
@@ -46,3 +50,11 @@ func InitLogger(debugMode bool) {
 
 	Logger = zap.New(core, zap.AddStacktrace(zapcore.FatalLevel))
 }
+
+// CloseLogger flushes the logger and closes the log file.
+func CloseLogger() {
+	Logger.Sync()
+	if logFile != nil {
+		logFile.Close()
+	}
+}
@@ -1,23 +1,43 @@
 package utils
 
 import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/cache"
+	"EverythingSuckz/fsb/internal/metrics"
+	"EverythingSuckz/fsb/internal/types"
 	"context"
 	"fmt"
 	"io"
+	"slices"
+	"sync"
+	"time"
 
-	"github.com/celestix/gotgproto"
 	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
 	"go.uber.org/zap"
 )
 
+// maxFloodWaits is how many times a chunk waits for a flood wait to end
+// when no other worker is free.
+const maxFloodWaits = 10
+
 type telegramReader struct {
 	ctx           context.Context
+	cancel        context.CancelFunc
 	log           *zap.Logger
-	client        *gotgproto.Client
-	location      tg.InputFileLocationClass
+	workers       []*bot.Worker
+	messageID     int
+	file          *types.File
+	locations     map[int]tg.InputFileLocationClass
+	mu            sync.Mutex
+	refreshMu     sync.Mutex
+	failed        map[int]bool
+	failovers     int
+	closeOnce     sync.Once
 	start         int64
 	end           int64
-	next          func() ([]byte, error)
+	parts         chan chan chunkResult
 	buffer        []byte
 	bytesread     int64
 	chunkSize     int64
@@ -25,31 +45,60 @@ type telegramReader struct {
 	contentLength int64
 }
 
-func (*telegramReader) Close() error {
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+func (r *telegramReader) Close() error {
+	r.cancel()
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, worker := range r.workers {
+			worker.StreamFinished()
+		}
+		metrics.ActiveStreams.Dec()
+	})
 	return nil
 }
 
+// NewTelegramReader streams the given byte range of the file stored in the
+// log channel message. Chunks are requested from the workers in turn, the
+// first worker must be the one file was resolved with.
 func NewTelegramReader(
 	ctx context.Context,
-	client *gotgproto.Client,
-	location tg.InputFileLocationClass,
+	workers []*bot.Worker,
+	messageID int,
+	file *types.File,
 	start int64,
 	end int64,
 	contentLength int64,
 ) (io.ReadCloser, error) {
-
+	ctx, cancel := context.WithCancel(ctx)
 	r := &telegramReader{
 		ctx:           ctx,
+		cancel:        cancel,
 		log:           Logger.Named("telegramReader"),
-		location:      location,
-		client:        client,
+		workers:       workers,
+		messageID:     messageID,
+		file:          file,
+		locations:     map[int]tg.InputFileLocationClass{workers[0].ID: file.Location},
+		failed:        make(map[int]bool),
 		start:         start,
 		end:           end,
 		chunkSize:     int64(1024 * 1024),
 		contentLength: contentLength,
+		// the part being consumed by Read counts towards the window,
+		// hence the channel only buffers the remaining ones.
+		parts: make(chan chan chunkResult, config.ValueOf.StreamConcurrency-1),
+	}
+	for _, worker := range workers {
+		worker.StreamStarted()
 	}
+	metrics.ActiveStreams.Inc()
 	r.log.Sugar().Debug("Start")
-	r.next = r.partStream()
+	go r.prefetch()
 	return r, nil
 }
 
@@ -66,14 +115,6 @@ func (r *telegramReader) Read(p []byte) (n int, err error) {
 		if err != nil {
 			return 0, err
 		}
-		if len(r.buffer) == 0 {
-			r.next = r.partStream()
-			r.buffer, err = r.next()
-			if err != nil {
-				return 0, err
-			}
-
-		}
 		r.i = 0
 	}
 	n = copy(p, r.buffer[r.i:])
@@ -82,15 +123,238 @@ func (r *telegramReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
-func (r *telegramReader) chunk(offset int64, limit int64) ([]byte, error) {
+// next waits for the next part in file order.
+func (r *telegramReader) next() ([]byte, error) {
+	var part chan chunkResult
+	select {
+	case <-r.ctx.Done():
+		return nil, r.ctx.Err()
+	case p, ok := <-r.parts:
+		if !ok {
+			return nil, io.ErrUnexpectedEOF
+		}
+		part = p
+	}
+	select {
+	case <-r.ctx.Done():
+		return nil, r.ctx.Err()
+	case res := <-part:
+		if res.err == nil && len(res.data) == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return res.data, res.err
+	}
+}
+
+// location returns the file location as seen by the worker. File
+// references are tied to the account that fetched them, so every worker
+// has to resolve the message on its own.
+func (r *telegramReader) location(worker *bot.Worker) (tg.InputFileLocationClass, error) {
+	r.mu.Lock()
+	location, ok := r.locations[worker.ID]
+	r.mu.Unlock()
+	if ok {
+		return location, nil
+	}
+	file, err := FileFromMessage(r.ctx, worker.Client(), r.messageID)
+	if err != nil {
+		return nil, err
+	}
+	if file.ID != r.file.ID {
+		return nil, fmt.Errorf("worker %d resolved a different file", worker.ID)
+	}
+	r.mu.Lock()
+	r.locations[worker.ID] = file.Location
+	r.mu.Unlock()
+	return file.Location, nil
+}
+
+// refreshLocation replaces the expired location of the worker. Chunks
+// fetched in parallel hit the expiry together, only the first one goes
+// back to telegram.
+func (r *telegramReader) refreshLocation(worker *bot.Worker, expired tg.InputFileLocationClass) (tg.InputFileLocationClass, error) {
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+	r.mu.Lock()
+	current := r.locations[worker.ID]
+	r.mu.Unlock()
+	if current != expired {
+		return current, nil
+	}
+	r.log.Debug("File reference expired, refreshing", zap.Int("workerID", worker.ID), zap.Int("messageID", r.messageID))
+	file, err := RefreshFileFromMessage(r.ctx, worker.Client(), r.messageID)
+	if err != nil {
+		return nil, err
+	}
+	if file.ID != r.file.ID {
+		return nil, fmt.Errorf("worker %d resolved a different file", worker.ID)
+	}
+	r.mu.Lock()
+	r.locations[worker.ID] = file.Location
+	r.mu.Unlock()
+	return file.Location, nil
+}
+
+// chunk returns the chunk at offset from the disk cache when possible and
+// downloads it through the worker otherwise. When the worker fails, the
+// same offset is requested from another worker.
+func (r *telegramReader) chunk(worker *bot.Worker, offset int64, limit int64) ([]byte, error) {
+	chunks := cache.GetChunkCache()
+	if chunks != nil {
+		if data, ok := chunks.Get(r.file.ID, offset); ok {
+			return data, nil
+		}
+	}
+	data, err := r.download(worker, offset, limit)
+	for waits := 0; err != nil; {
+		if r.ctx.Err() != nil {
+			return nil, err
+		}
+		if d, ok := tgerr.AsFloodWait(err); ok {
+			if next := r.reroute(worker); next != nil {
+				worker = next
+			} else {
+				waits++
+				if waits > maxFloodWaits || !r.sleep(d) {
+					return nil, err
+				}
+			}
+			data, err = r.download(worker, offset, limit)
+			continue
+		}
+		next := r.failover(worker, err)
+		if next == nil {
+			return nil, err
+		}
+		worker = next
+		data, err = r.download(worker, offset, limit)
+	}
+	if chunks != nil {
+		if err := chunks.Put(r.file.ID, offset, data); err != nil {
+			r.log.Warn("Failed to cache chunk", zap.Int64("offset", offset), zap.Error(err))
+		}
+	}
+	return data, nil
+}
+
+// workerFor picks the worker of a part, skipping the ones that failed
+// during this stream and preferring the ones that aren't flood waiting.
+func (r *telegramReader) workerFor(part int) *bot.Worker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var waiting *bot.Worker
+	for i := range r.workers {
+		worker := r.workers[(part+i)%len(r.workers)]
+		if r.failed[worker.ID] {
+			continue
+		}
+		if worker.FloodWait() == 0 {
+			return worker
+		}
+		if waiting == nil {
+			waiting = worker
+		}
+	}
+	if waiting != nil {
+		return waiting
+	}
+	return r.workers[part%len(r.workers)]
+}
+
+// failover takes the worker out of this stream and returns the worker
+// that should retry the failed request, nil once MAX_FAILOVERS is reached
+// or no other worker is left.
+func (r *telegramReader) failover(worker *bot.Worker, err error) *bot.Worker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed[worker.ID] = true
+	worker.RecordError()
+	if r.failovers >= config.ValueOf.MaxFailovers {
+		r.log.Warn("Giving up after too many failovers", zap.Int("workerID", worker.ID), zap.Error(err))
+		return nil
+	}
+	next := bot.GetFailoverWorker(r.failed)
+	if next == nil {
+		r.log.Warn("No worker left to fail over to", zap.Int("workerID", worker.ID), zap.Error(err))
+		return nil
+	}
+	r.failovers++
+	r.log.Warn("Worker failed, failing over",
+		zap.Int("workerID", worker.ID),
+		zap.Int("nextWorkerID", next.ID),
+		zap.Int("failovers", r.failovers),
+		zap.Error(err))
+	r.use(next)
+	return next
+}
+
+// reroute returns a worker that isn't flood waiting to download the chunk
+// instead of worker, nil if every worker is waiting. Unlike failover, the
+// waiting worker stays usable for the next chunks.
+func (r *telegramReader) reroute(worker *bot.Worker) *bot.Worker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := bot.GetFailoverWorker(r.failed)
+	if next == nil {
+		return nil
+	}
+	r.log.Debug("Worker is flood waiting, rerouting chunk",
+		zap.Int("workerID", worker.ID),
+		zap.Int("nextWorkerID", next.ID),
+		zap.Duration("wait", worker.FloodWait()))
+	r.use(next)
+	return next
+}
+
+// use adds the worker to the ones serving the stream, mu must be held.
+func (r *telegramReader) use(worker *bot.Worker) {
+	if !slices.Contains(r.workers, worker) {
+		worker.StreamStarted()
+		r.workers = append(r.workers, worker)
+	}
+}
+
+// sleep waits for d unless the stream is closed first.
+func (r *telegramReader) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+func (r *telegramReader) uploadGetFile(worker *bot.Worker, req *tg.UploadGetFileRequest) (tg.UploadFileClass, error) {
+	start := time.Now()
+	res, err := worker.Client().API().UploadGetFile(r.ctx, req)
+	worker.ObserveDownload(time.Since(start), err)
+	return res, err
+}
+
+func (r *telegramReader) download(worker *bot.Worker, offset int64, limit int64) ([]byte, error) {
+
+	location, err := r.location(worker)
+	if err != nil {
+		return nil, err
+	}
 
 	req := &tg.UploadGetFileRequest{
 		Offset:   offset,
 		Limit:    int(limit),
-		Location: r.location,
+		Location: location,
 	}
 
-	res, err := r.client.API().UploadGetFile(r.ctx, req)
+	res, err := r.uploadGetFile(worker, req)
+
+	if tgerr.Is(err, "FILE_REFERENCE_EXPIRED", "FILE_REFERENCE_INVALID") {
+		req.Location, err = r.refreshLocation(worker, location)
+		if err != nil {
+			return nil, err
+		}
+		res, err = r.uploadGetFile(worker, req)
+	}
 
 	if err != nil {
 		return nil, err
@@ -104,39 +368,67 @@ func (r *telegramReader) chunk(offset int64, limit int64) ([]byte, error) {
 	}
 }
 
-func (r *telegramReader) partStream() func() ([]byte, error) {
-
-	start := r.start
-	end := r.end
-	offset := start - (start % r.chunkSize)
+// prefetch keeps up to STREAM_CONCURRENCY chunk requests in flight and
+// queues their results in file order. Parts are striped across the
+// workers. It stops once every part has been requested or the reader is
+// closed.
+func (r *telegramReader) prefetch() {
+	defer close(r.parts)
 
-	firstPartCut := start - offset
-	lastPartCut := (end % r.chunkSize) + 1
-	partCount := int((end - offset + r.chunkSize) / r.chunkSize)
-	currentPart := 1
+	offset, partCount := chunkSpan(r.start, r.end, r.chunkSize)
 
-	readData := func() ([]byte, error) {
-		if currentPart > partCount {
-			return make([]byte, 0), nil
+	for currentPart := 1; currentPart <= partCount; currentPart++ {
+		part := make(chan chunkResult, 1)
+		select {
+		case <-r.ctx.Done():
+			return
+		case r.parts <- part:
 		}
-		res, err := r.chunk(offset, r.chunkSize)
-		if err != nil {
-			return nil, err
-		}
-		if len(res) == 0 {
-			return res, nil
-		} else if partCount == 1 {
-			res = res[firstPartCut:lastPartCut]
-		} else if currentPart == 1 {
-			res = res[firstPartCut:]
-		} else if currentPart == partCount {
-			res = res[:lastPartCut]
-		}
-
-		currentPart++
+		worker := r.workerFor(currentPart - 1)
+		go func(currentPart int, offset int64) {
+			res, err := r.chunk(worker, offset, r.chunkSize)
+			if err != nil {
+				part <- chunkResult{err: err}
+				return
+			}
+			from, to := partBounds(r.start, r.end, r.chunkSize, currentPart, partCount)
+			res = cut(res, from, to)
+			r.log.Sugar().Debugf("Part %d/%d (worker %d)", currentPart, partCount, worker.ID)
+			part <- chunkResult{data: res}
+		}(currentPart, offset)
 		offset += r.chunkSize
-		r.log.Sugar().Debugf("Part %d/%d", currentPart, partCount)
-		return res, nil
 	}
-	return readData
+}
+
+// chunkSpan returns the offset of the chunk holding the first byte of the
+// range start-end, and how many chunks the range spans.
+func chunkSpan(start, end, chunkSize int64) (offset int64, partCount int) {
+	offset = start - start%chunkSize
+	return offset, int((end - offset + chunkSize) / chunkSize)
+}
+
+// partBounds returns the bytes of the currentPart-th chunk, counting from
+// 1, that belong to the range start-end. Only the first and the last chunk
+// are cut.
+func partBounds(start, end, chunkSize int64, currentPart, partCount int) (from, to int64) {
+	from, to = 0, chunkSize
+	if currentPart == 1 {
+		from = start % chunkSize
+	}
+	if currentPart == partCount {
+		to = end%chunkSize + 1
+	}
+	return from, to
+}
+
+// cut is res[from:to] clamped to the length of res, telegram returns short
+// chunks at the end of the file.
+func cut(res []byte, from, to int64) []byte {
+	if to > int64(len(res)) {
+		to = int64(len(res))
+	}
+	if from > to {
+		from = to
+	}
+	return res[from:to]
 }
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPartBounds(t *testing.T) {
+	const chunkSize = 100
+	tests := []struct {
+		name          string
+		start, end    int64
+		wantOffset    int64
+		wantPartCount int
+		// wantBounds holds the from and to of every part
+		wantBounds [][2]int64
+	}{
+		{"whole chunk", 0, 99, 0, 1, [][2]int64{{0, 100}}},
+		{"inside one chunk", 10, 19, 0, 1, [][2]int64{{10, 20}}},
+		{"inside a later chunk", 210, 289, 200, 1, [][2]int64{{10, 90}}},
+		{"single byte", 150, 150, 100, 1, [][2]int64{{50, 51}}},
+		{"end on a chunk boundary", 10, 199, 0, 2, [][2]int64{{10, 100}, {0, 100}}},
+		{"end right after a boundary", 10, 200, 0, 3, [][2]int64{{10, 100}, {0, 100}, {0, 1}}},
+		{"start on a chunk boundary", 100, 250, 100, 2, [][2]int64{{0, 100}, {0, 51}}},
+		{"last byte of a chunk", 99, 99, 0, 1, [][2]int64{{99, 100}}},
+		{"across chunks", 50, 349, 0, 4, [][2]int64{{50, 100}, {0, 100}, {0, 100}, {0, 50}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, partCount := chunkSpan(tt.start, tt.end, chunkSize)
+			if offset != tt.wantOffset || partCount != tt.wantPartCount {
+				t.Fatalf("chunkSpan() = %d, %d, want %d, %d", offset, partCount, tt.wantOffset, tt.wantPartCount)
+			}
+			for part := 1; part <= partCount; part++ {
+				from, to := partBounds(tt.start, tt.end, chunkSize, part, partCount)
+				if want := tt.wantBounds[part-1]; from != want[0] || to != want[1] {
+					t.Errorf("partBounds() of part %d = %d, %d, want %d, %d", part, from, to, want[0], want[1])
+				}
+			}
+		})
+	}
+}
+
+// TestPartsReassemble cuts the chunks of a file the way prefetch does and
+// checks that they add up to the requested range, Telegram returning a
+// short last chunk at the end of the file.
+func TestPartsReassemble(t *testing.T) {
+	const chunkSize = 100
+	file := make([]byte, 350)
+	for i := range file {
+		file[i] = byte(i)
+	}
+	tests := []struct {
+		name       string
+		start, end int64
+	}{
+		{"inside one chunk", 10, 19},
+		{"end on a chunk boundary", 0, 199},
+		{"across chunks", 50, 249},
+		{"whole file", 0, 349},
+		{"short last chunk", 120, 349},
+		{"inside the short last chunk", 310, 340},
+		{"last byte", 349, 349},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, partCount := chunkSpan(tt.start, tt.end, chunkSize)
+			var got []byte
+			for part := 1; part <= partCount; part++ {
+				chunk := file[offset:min(offset+chunkSize, int64(len(file)))]
+				from, to := partBounds(tt.start, tt.end, chunkSize, part, partCount)
+				got = append(got, cut(chunk, from, to)...)
+				offset += chunkSize
+			}
+			if want := file[tt.start : tt.end+1]; !bytes.Equal(got, want) {
+				t.Errorf("got %d bytes starting with %d, want %d bytes starting with %d", len(got), got[0], len(want), want[0])
+			}
+		})
+	}
+}
+
+func TestCut(t *testing.T) {
+	res := []byte("0123456789")
+	tests := []struct {
+		name     string
+		from, to int64
+		want     string
+	}{
+		{"inside", 2, 5, "234"},
+		{"whole", 0, 10, "0123456789"},
+		{"to past the end", 5, 100, "56789"},
+		{"from past the end", 20, 100, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(cut(res, tt.from, tt.to)); got != tt.want {
+				t.Errorf("cut(%d, %d) = %q, want %q", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
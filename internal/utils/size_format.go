@@ -0,0 +1,17 @@
+package utils
+
+import "fmt"
+
+// SizeFormat formats a number of bytes with a binary unit, like 1.5 GiB.
+func SizeFormat(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
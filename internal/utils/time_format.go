@@ -3,8 +3,12 @@ package utils
 import (
 	"fmt"
 	"math/bits"
+	"time"
 )
 
+// StartTime is when the server was started.
+var StartTime = time.Now()
+
 func TimeFormat(seconds uint64) (timeStr string) {
 	hours, remainder := bits.Div64(0, seconds, 3600)
 	minutes, seconds := bits.Div64(0, remainder, 60)